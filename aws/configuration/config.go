@@ -22,6 +22,22 @@ func NewConfig(dir string, profile string) *Config {
 	}
 }
 
+// Region returns the region of the profile in ~/.aws/config, or empty if not configured
+func (c *Config) Region() (string, error) {
+	configIni, err := ini.Load(c.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	name := fmt.Sprintf("profile %s", c.profile)
+	if c.profile == "default" && !configIni.Section(name).HasKey("region") {
+		name = "default"
+	}
+	return configIni.Section(name).Key("region").String(), nil
+}
+
 // Save to ~/.aws/config
 func (c *Config) Save(region string) error {
 	configIni, err := ini.Load(c.file)
@@ -126,3 +126,65 @@ region = ap-northeast-1
 		})
 	}
 }
+
+func TestConfig_Region(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		profile string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "profile",
+			content: `[profile test]
+region = ap-northeast-1
+`,
+			profile: "test",
+			want:    "ap-northeast-1",
+		},
+		{
+			name: "default section",
+			content: `[default]
+region = us-east-1
+`,
+			profile: "default",
+			want:    "us-east-1",
+		},
+		{
+			name: "not configured",
+			content: `[profile other]
+region = us-east-1
+`,
+			profile: "test",
+			want:    "",
+		},
+		{
+			name:    "no file",
+			profile: "test",
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+			if err != nil {
+				t.Errorf("%#v", err)
+			}
+			defer os.RemoveAll(dir)
+			c := NewConfig(dir, tt.profile)
+			if tt.content != "" {
+				if err := ioutil.WriteFile(c.file, []byte(tt.content), 0600); err != nil {
+					t.Errorf("%#v", err)
+				}
+			}
+			got, err := c.Region()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Region() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Config.Region() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// DefaultEndpoint is AWS federation endpoint
+const DefaultEndpoint = "https://signin.aws.amazon.com/federation"
+
+// DefaultDestination is AWS console URL
+const DefaultDestination = "https://console.aws.amazon.com/"
+
+// Federation AWS federation endpoint client
+type Federation struct {
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+type session struct {
+	SessionID    string `json:"sessionId"`
+	SessionKey   string `json:"sessionKey"`
+	SessionToken string `json:"sessionToken"`
+}
+
+// SigninTokenResponse response of getSigninToken
+type SigninTokenResponse struct {
+	SigninToken string
+}
+
+// New creates a Federation
+func New(endpoint string) *Federation {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Federation{
+		Endpoint:   endpoint,
+		HTTPClient: &http.Client{},
+	}
+}
+
+// SigninToken exchanges the credentials for a SigninToken.
+// The duration is omitted if it is zero.
+func (f *Federation) SigninToken(creds *sts.Credentials, duration int64) (string, error) {
+	return f.SigninTokenWithContext(context.Background(), creds, duration)
+}
+
+// SigninTokenWithContext is SigninToken canceled with the context
+func (f *Federation) SigninTokenWithContext(ctx context.Context, creds *sts.Credentials, duration int64) (string, error) {
+	if creds == nil || creds.AccessKeyId == nil || creds.SecretAccessKey == nil || creds.SessionToken == nil {
+		return "", errors.Errorf("AWS credentials are not exists")
+	}
+	s, err := json.Marshal(&session{
+		SessionID:    *creds.AccessKeyId,
+		SessionKey:   *creds.SecretAccessKey,
+		SessionToken: *creds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(s))
+	if duration != 0 {
+		query.Set("SessionDuration", strconv.FormatInt(duration, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?%s", f.Endpoint, query.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := f.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("[%d] failed to get SigninToken", res.StatusCode)
+	}
+	var output SigninTokenResponse
+	if err := json.Unmarshal(body, &output); err != nil {
+		return "", err
+	}
+	if output.SigninToken == "" {
+		return "", errors.Errorf("SigninToken is not exists")
+	}
+	return output.SigninToken, nil
+}
+
+// LoginURL returns the console login URL of the SigninToken
+func (f *Federation) LoginURL(token string, issuer string, destination string) string {
+	if destination == "" {
+		destination = DefaultDestination
+	}
+	query := url.Values{}
+	query.Set("Action", "login")
+	if issuer != "" {
+		query.Set("Issuer", issuer)
+	}
+	query.Set("Destination", destination)
+	query.Set("SigninToken", token)
+	return fmt.Sprintf("%s?%s", f.Endpoint, query.Encode())
+}
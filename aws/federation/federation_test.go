@@ -0,0 +1,142 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func createCredentials() *sts.Credentials {
+	expiration := time.Now().Add(time.Hour)
+	return &sts.Credentials{
+		AccessKeyId:     StringRef("access-key-id"),
+		SecretAccessKey: StringRef("secret-access-key"),
+		SessionToken:    StringRef("session-token"),
+		Expiration:      &expiration,
+	}
+}
+
+func TestNew(t *testing.T) {
+	if f := New(""); f.Endpoint != DefaultEndpoint {
+		t.Errorf("%s is not equal %s", f.Endpoint, DefaultEndpoint)
+	}
+	if f := New("http://127.0.0.1/federation"); f.Endpoint != "http://127.0.0.1/federation" {
+		t.Errorf("%s is not equal %s", f.Endpoint, "http://127.0.0.1/federation")
+	}
+}
+
+func TestFederation_SigninToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		duration     int64
+		code         int
+		body         string
+		wantDuration string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:     "success",
+			code:     200,
+			body:     `{"SigninToken":"signin-token"}`,
+			want:     "signin-token",
+			duration: 0,
+		},
+		{
+			name:         "with duration",
+			code:         200,
+			body:         `{"SigninToken":"signin-token"}`,
+			want:         "signin-token",
+			duration:     3600,
+			wantDuration: "3600",
+		},
+		{
+			name:    "invalid credentials",
+			code:    400,
+			body:    `Bad Request`,
+			wantErr: true,
+		},
+		{
+			name:    "empty token",
+			code:    200,
+			body:    `{}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("Action") != "getSigninToken" {
+					t.Errorf("%s is not equal %s", query.Get("Action"), "getSigninToken")
+				}
+				if query.Get("SessionDuration") != tt.wantDuration {
+					t.Errorf("'%s' is not equal '%s'", query.Get("SessionDuration"), tt.wantDuration)
+				}
+				var s session
+				if err := json.Unmarshal([]byte(query.Get("Session")), &s); err != nil {
+					t.Errorf("%v", err)
+				}
+				if s.SessionID != "access-key-id" || s.SessionKey != "secret-access-key" || s.SessionToken != "session-token" {
+					t.Errorf("%#v is not valid session", s)
+				}
+				w.WriteHeader(tt.code)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+			got, err := New(ts.URL).SigninToken(createCredentials(), tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Federation.SigninToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Federation.SigninToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederation_SigninTokenWithContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"SigninToken":"signin-token"}`))
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(ts.URL).SigninTokenWithContext(ctx, createCredentials(), 0); err != context.Canceled {
+		t.Errorf("%v is not equal %v", err, context.Canceled)
+	}
+}
+
+func TestFederation_LoginURL(t *testing.T) {
+	f := New("")
+	got, err := url.Parse(f.LoginURL("signin-token", "https://example.com/", ""))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	query := got.Query()
+	expected := map[string]string{
+		"Action":      "login",
+		"Issuer":      "https://example.com/",
+		"Destination": DefaultDestination,
+		"SigninToken": "signin-token",
+	}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("%s: %s is not equal %s", key, query.Get(key), value)
+		}
+	}
+	if got.Host != "signin.aws.amazon.com" {
+		t.Errorf("%s is not equal %s", got.Host, "signin.aws.amazon.com")
+	}
+}
+
+func StringRef(v string) *string {
+	return &v
+}
@@ -0,0 +1,90 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RoleAttributeName is the SAML attribute listing the AWS roles of the user
+const RoleAttributeName = "https://aws.amazon.com/SAML/Attributes/Role"
+
+// Role represents a pair of AWS Role ARN and SAML Provider ARN
+type Role struct {
+	RoleArn      string
+	PrincipalArn string
+}
+
+// Name returns the role name part of the Role ARN
+func (r Role) Name() string {
+	i := strings.LastIndex(r.RoleArn, "/")
+	return r.RoleArn[i+1:]
+}
+
+// Match reports whether the role is identified by the value.
+// The value is compared with the Role ARN and the role name.
+func (r Role) Match(value string) bool {
+	return r.RoleArn == value || r.Name() == value
+}
+
+type response struct {
+	Assertion struct {
+		AttributeStatement struct {
+			Attributes []attribute `xml:"Attribute"`
+		} `xml:"AttributeStatement"`
+	} `xml:"Assertion"`
+}
+
+type attribute struct {
+	Name   string   `xml:"Name,attr"`
+	Values []string `xml:"AttributeValue"`
+}
+
+// ParseRoles returns AWS roles in the base64 encoded SAML Response
+func ParseRoles(assertion string) ([]Role, error) {
+	data, err := base64.StdEncoding.DecodeString(assertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "SAML Response is not base64 encoded")
+	}
+	var res response
+	if err := xml.Unmarshal(data, &res); err != nil {
+		return nil, errors.Wrap(err, "SAML Response is not valid")
+	}
+	roles := []Role{}
+	for _, attr := range res.Assertion.AttributeStatement.Attributes {
+		if attr.Name != RoleAttributeName {
+			continue
+		}
+		for _, value := range attr.Values {
+			role, err := ParseRole(value)
+			if err != nil {
+				return nil, err
+			}
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return nil, errors.Errorf("There is no AWS role in SAML Response")
+	}
+	return roles, nil
+}
+
+// ParseRole parses the value of the role attribute "role-arn,provider-arn" in either order
+func ParseRole(value string) (Role, error) {
+	var role Role
+	for _, arn := range strings.Split(strings.TrimSpace(value), ",") {
+		arn = strings.TrimSpace(arn)
+		switch {
+		case strings.Contains(arn, ":role/"):
+			role.RoleArn = arn
+		case strings.Contains(arn, ":saml-provider/"):
+			role.PrincipalArn = arn
+		}
+	}
+	if role.RoleArn == "" || role.PrincipalArn == "" {
+		return Role{}, errors.Errorf("%s is not valid AWS role attribute", value)
+	}
+	return role, nil
+}
@@ -0,0 +1,129 @@
+package saml
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+const samlResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml:AttributeValue>username</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/Admin,arn:aws:iam::123456789012:saml-provider/OneLogin</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::123456789012:saml-provider/OneLogin, arn:aws:iam::123456789012:role/ReadOnly</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+const samlResponseWithoutRoles = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml:AttributeValue>username</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+const samlResponseWithInvalidRole = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/Admin</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestParseRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion string
+		want      []Role
+		wantErr   bool
+	}{
+		{
+			name:      "roles",
+			assertion: base64.StdEncoding.EncodeToString([]byte(samlResponse)),
+			want: []Role{
+				{
+					RoleArn:      "arn:aws:iam::123456789012:role/Admin",
+					PrincipalArn: "arn:aws:iam::123456789012:saml-provider/OneLogin",
+				},
+				{
+					RoleArn:      "arn:aws:iam::123456789012:role/ReadOnly",
+					PrincipalArn: "arn:aws:iam::123456789012:saml-provider/OneLogin",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:      "no roles",
+			assertion: base64.StdEncoding.EncodeToString([]byte(samlResponseWithoutRoles)),
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid role",
+			assertion: base64.StdEncoding.EncodeToString([]byte(samlResponseWithInvalidRole)),
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "not base64",
+			assertion: "Base64 encoded SAML Data",
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "not xml",
+			assertion: base64.StdEncoding.EncodeToString([]byte("SAML Data")),
+			want:      nil,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoles(tt.assertion)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRoles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRole_Match(t *testing.T) {
+	role := Role{
+		RoleArn:      "arn:aws:iam::123456789012:role/path/Admin",
+		PrincipalArn: "arn:aws:iam::123456789012:saml-provider/OneLogin",
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "arn", value: "arn:aws:iam::123456789012:role/path/Admin", want: true},
+		{name: "name", value: "Admin", want: true},
+		{name: "other", value: "ReadOnly", want: false},
+		{name: "partial", value: "Adm", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := role.Match(tt.value); got != tt.want {
+				t.Errorf("Role.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,33 +1,73 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
 )
 
 // Config stores config
 type Config struct {
-	Service map[string]*ServiceConfig `toml:"service"`
-	App     map[string]*AppConfig     `toml:"app"`
-	file    string                    `toml:"-"`
+	SecretStore     string                    `toml:"secret_store,omitempty"`
+	CacheEncryption string                    `toml:"cache_encryption,omitempty"`
+	Service         map[string]*ServiceConfig `toml:"service"`
+	App             map[string]*AppConfig     `toml:"app"`
+	file            string                    `toml:"-"`
+	store           secret.Store              `toml:"-"`
 }
 
 // ServiceConfig stores initialized data
 type ServiceConfig struct {
+	// Endpoint is the host of OneLogin API, or the base URL with the scheme, the port and the path prefix
 	Endpoint        string `toml:"endpoint"`
 	ClientToken     string `toml:"client_token"`
-	ClientSecret    string `toml:"client_secret"`
+	ClientSecret    string `toml:"client_secret,omitempty"`
 	Subdomain       string `toml:"subdomain"`
 	UsernameOrEmail string `toml:"username_or_email"`
+	MFADevice       string `toml:"mfa_device,omitempty"`
+	// PasswordSource is the source of the password of the service such as "keyring:password.SERVICE",
+	// which is used without --password-source
+	PasswordSource string `toml:"password_source,omitempty"`
+	// APIVersion is the version of OneLogin SAML assertion API, which is 1 if it is zero
+	APIVersion int `toml:"api_version,omitzero"`
+	// CABundle is the PEM file of CA certificates trusted in addition to the system certificates
+	CABundle string `toml:"ca_bundle,omitempty"`
+	// STSEndpoint is the endpoint of AWS STS such as the fake STS of mock-server
+	STSEndpoint string `toml:"sts_endpoint,omitempty"`
 }
 
+// DefaultService is the name of the service used by the apps without the service
+const DefaultService = "default"
+
 // AppConfig stores configured data
 type AppConfig struct {
-	AppID           string `toml:"app_id"`
+	// Service is the name of the service to login, which is DefaultService if it is empty
+	Service         string        `toml:"service,omitempty"`
+	AppID           string        `toml:"app_id"`
+	RoleArn         string        `toml:"role_arn"`
+	PrincipalArn    string        `toml:"principal_arn"`
+	DurationSeconds int64         `toml:"duration_seconds"`
+	MFADevice       string        `toml:"mfa_device,omitempty"`
+	Chain           []ChainedRole `toml:"chain,omitempty"`
+}
+
+// ChainedRole stores a role assumed after the SAML assumed role
+type ChainedRole struct {
 	RoleArn         string `toml:"role_arn"`
-	PrincipalArn    string `toml:"principal_arn"`
-	DurationSeconds int64  `toml:"duration_seconds"`
+	ExternalID      string `toml:"external_id,omitempty"`
+	SessionName     string `toml:"session_name,omitempty"`
+	DurationSeconds int64  `toml:"duration_seconds,omitzero"`
+}
+
+// ServiceName returns the name of the service to login
+func (a *AppConfig) ServiceName() string {
+	if a.Service == "" {
+		return DefaultService
+	}
+	return a.Service
 }
 
 // Load creates a Loaded Config
@@ -49,8 +89,49 @@ func Load(file string) (*Config, error) {
 	return &config, nil
 }
 
+// UseStore keeps the client secrets in the store instead of the config file.
+// The secrets not in the config file are loaded from the store.
+func (c *Config) UseStore(store secret.Store) error {
+	if store != nil {
+		for name, service := range c.Service {
+			if service.ClientSecret != "" {
+				continue
+			}
+			value, err := store.Get(ClientSecretKey(name))
+			if err != nil {
+				if err == secret.ErrNotFound {
+					continue
+				}
+				return err
+			}
+			service.ClientSecret = value
+		}
+	}
+	c.store = store
+	return nil
+}
+
+// ClientSecretKey returns the key of the client secret of the service in the secret store
+func ClientSecretKey(service string) string {
+	return fmt.Sprintf("service.%s.client_secret", service)
+}
+
 // Save to persistent store
 func (c Config) Save() error {
+	if c.store != nil {
+		services := map[string]*ServiceConfig{}
+		for name, service := range c.Service {
+			if service.ClientSecret != "" {
+				if err := c.store.Set(ClientSecretKey(name), service.ClientSecret); err != nil {
+					return err
+				}
+			}
+			s := *service
+			s.ClientSecret = ""
+			services[name] = &s
+		}
+		c.Service = services
+	}
 	fd, err := os.Create(c.file)
 	if err != nil {
 		return err
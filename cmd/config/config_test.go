@@ -6,6 +6,8 @@ import (
 	"os"
 	"path"
 	"testing"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
 )
 
 func TestLoadNoFile(t *testing.T) {
@@ -230,3 +232,141 @@ func TestLoadNormalFile(t *testing.T) {
 		t.Errorf("%v is not equal %v", actual, expected)
 	}
 }
+
+func TestLoadChainFile(t *testing.T) {
+	source, err := os.Open("../fixtures/chainconfig.toml")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	file := dist.Name()
+
+	defer os.Remove(file)
+	_, err = io.Copy(dist, source)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	c, err := Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	chain := c.App["default"].Chain
+	if len(chain) != 2 {
+		t.Errorf("Chain is not loaded: %#v", chain)
+	}
+	if chain[1].ExternalID != "external-id" {
+		t.Errorf("%s is not equal %s", chain[1].ExternalID, "external-id")
+	}
+	err = c.Save()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	actual := string(data)
+	expected := `[service]
+  [service.default]
+    endpoint = "api-server"
+    client_token = "client-token"
+    client_secret = "client-secret"
+    subdomain = "subdomain"
+    username_or_email = "username-or-email"
+
+[app]
+  [app.default]
+    app_id = "app-id"
+    role_arn = "role-arn"
+    principal_arn = "provider-arn"
+    duration_seconds = 3600
+
+    [[app.default.chain]]
+      role_arn = "hub-role-arn"
+
+    [[app.default.chain]]
+      role_arn = "workload-role-arn"
+      external_id = "external-id"
+      session_name = "session-name"
+      duration_seconds = 900
+`
+	if actual != expected {
+		t.Errorf("%s is not equal %s", actual, expected)
+	}
+}
+
+func TestUseStore(t *testing.T) {
+	source, err := os.Open("../fixtures/serviceconfig.toml")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	file := dist.Name()
+
+	defer os.Remove(file)
+	_, err = io.Copy(dist, source)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	passphrase := func() (string, error) {
+		return "passphrase", nil
+	}
+	store := secret.NewFile(path.Join(dir, "secrets.enc"), passphrase)
+
+	c, err := Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	c.SecretStore = "file"
+	if err := c.UseStore(store); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := c.Save(); err != nil {
+		t.Errorf("%#v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	actual := string(data)
+	expected := `secret_store = "file"
+
+[service]
+  [service.default]
+    endpoint = "api-server"
+    client_token = "client-token"
+    subdomain = "subdomain"
+    username_or_email = "username-or-email"
+
+[app]
+`
+	if actual != expected {
+		t.Errorf("%s is not equal %s", actual, expected)
+	}
+	if c.Service["default"].ClientSecret != "client-secret" {
+		t.Errorf("%s is not equal %s", c.Service["default"].ClientSecret, "client-secret")
+	}
+
+	c, err = Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := c.UseStore(secret.NewFile(path.Join(dir, "secrets.enc"), passphrase)); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.Service["default"].ClientSecret != "client-secret" {
+		t.Errorf("%s is not equal %s", c.Service["default"].ClientSecret, "client-secret")
+	}
+}
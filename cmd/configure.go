@@ -15,31 +15,35 @@
 package cmd
 
 import (
-	"log"
-
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
 )
 
 var appID string
 var roleArn string
 var principalArn string
 var duration int64
+var chainRoleArns []string
+var appService string
 
 // configureCmd represents the configure command
 var configureCmd = &cobra.Command{
-	Use:   "configure",
-	Short: "Add config to login to onelogin api",
-	Long:  `Configure is add config to login to onelogin api.`,
+	Use:    "configure",
+	Short:  "Add config to login to onelogin api",
+	Long:   `Configure is add config to login to onelogin api.`,
+	PreRun: openStores,
 	Run: func(cmd *cobra.Command, args []string) {
 		if awsProfile == "" {
 			awsProfile = "default"
 		}
 		if err := initAppConfig(configFile, awsProfile); err != nil {
-			errorExit(err)
+			errorExit(failure.Wrap(failure.Config, err))
 		}
+		printResult(map[string]string{"profile": awsProfile}, nil)
 	},
 }
 
@@ -49,6 +53,8 @@ func init() {
 	configureCmd.Flags().StringVarP(&roleArn, "role-arn", "", "", "Login Target AWS Role ARN")
 	configureCmd.Flags().StringVarP(&principalArn, "principal-arn", "", "", "AWS Provider ARN connected to OneLogin AppID")
 	configureCmd.Flags().Int64VarP(&duration, "duration", "", 3600, "The session duration to assuming the role")
+	configureCmd.Flags().StringSliceVarP(&chainRoleArns, "chain-role-arn", "", nil, "Comma separated AWS Role ARNs to assume in order after the login role")
+	configureCmd.Flags().StringVarP(&appService, "service", "", "", "Name of the OneLogin service to login (default \"default\")")
 	configureCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
 }
 
@@ -73,16 +79,31 @@ func initAppConfig(file string, profile string) error {
 	if duration != 0 {
 		appConfig.DurationSeconds = duration
 	}
-	serviceProfile := "default"
-	if _, ok := c.Service[serviceProfile]; !ok {
+	if mfaDevice != "" {
+		appConfig.MFADevice = mfaDevice
+	}
+	if len(chainRoleArns) > 0 {
+		appConfig.Chain = []config.ChainedRole{}
+		for _, arn := range chainRoleArns {
+			appConfig.Chain = append(appConfig.Chain, config.ChainedRole{RoleArn: arn})
+		}
+	}
+	if appService != "" {
+		appConfig.Service = appService
+		if appService == config.DefaultService {
+			appConfig.Service = ""
+		}
+	}
+	if _, ok := c.Service[appConfig.ServiceName()]; !ok {
+		if appConfig.ServiceName() != config.DefaultService {
+			return errors.Errorf("There is no initialized service %s. Please run `onelogin-aws-connector init --service %s`", appConfig.ServiceName(), appConfig.ServiceName())
+		}
 		return errors.Errorf("There is no initialized service. Please run `onelogin-aws-connector init`")
 	}
 	c.App[profile] = appConfig
 	if err := c.Save(); err != nil {
 		return err
 	}
-	if debug {
-		log.Printf("AppConfig: %#v\n", appConfig)
-	}
+	logging.Debug("app config", logging.F("app", appConfig))
 	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path"
 	"testing"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
 )
 
 func TestConfigureCmdWithoutInit(t *testing.T) {
@@ -128,4 +130,81 @@ func resetConfigureFlags() {
 	appID = ""
 	roleArn = ""
 	principalArn = ""
+	mfaDevice = ""
+	appService = ""
+}
+
+func TestConfigureCmdWithNamedService(t *testing.T) {
+	source, err := os.Open("fixtures/multiservice.toml")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	file := dist.Name()
+	defer os.Remove(file)
+	_, err = io.Copy(dist, source)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	resetConfigureFlags()
+	defer resetConfigureFlags()
+	appID = "sandbox-app-id"
+	appService = "sandbox"
+	if err := initAppConfig(file, "subsidiary"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.App["subsidiary"].Service != "sandbox" {
+		t.Errorf("%s is not equal %s", c.App["subsidiary"].Service, "sandbox")
+	}
+
+	appService = "unknown"
+	err = initAppConfig(file, "subsidiary")
+	errorMessage := "There is no initialized service unknown. Please run `onelogin-aws-connector init --service unknown`"
+	if err == nil || err.Error() != errorMessage {
+		t.Errorf("%v is not equal to %s", err, errorMessage)
+	}
+}
+
+func TestConfigureCmdWithMFADevice(t *testing.T) {
+	source, err := os.Open("fixtures/serviceconfig.toml")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	file := dist.Name()
+	defer os.Remove(file)
+	_, err = io.Copy(dist, source)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	resetConfigureFlags()
+	appID = "app-id"
+	mfaDevice = "Notify to OneLogin Protect"
+	defer resetConfigureFlags()
+	if err := initAppConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.App["default"].MFADevice != "Notify to OneLogin Protect" {
+		t.Errorf("%s is not equal %s", c.App["default"].MFADevice, "Notify to OneLogin Protect")
+	}
+	if c.Service["default"].MFADevice != "" {
+		t.Errorf("'%s' is not equal ''", c.Service["default"].MFADevice)
+	}
 }
@@ -0,0 +1,101 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/federation"
+)
+
+var destination string
+var issuer string
+var federationEndpoint string
+var sessionDuration int64
+var openBrowser bool
+
+// consoleCmd represents the console command
+var consoleCmd = &cobra.Command{
+	Use:   "console",
+	Short: "Print AWS console login URL",
+	Long: `Console exchanges AWS credentials of the profile for a SigninToken at AWS
+federation endpoint, and prints the AWS console login URL.`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		if awsProfile == "" {
+			awsProfile = "default"
+		}
+		promptOutput = os.Stderr
+		creds, err := cached(awsProfile, func() (*sts.Credentials, error) {
+			return authenticate(awsProfile, newInteractiveEvent())
+		})
+		if err != nil {
+			errorExit(err)
+		}
+		f := federation.New(federationEndpoint)
+		f.HTTPClient.Timeout = requestTimeout
+		ctx, cancel := loginContext(context.Background())
+		token, err := f.SigninTokenWithContext(ctx, creds, sessionDuration)
+		err = loginError(ctx, err)
+		cancel()
+		if err != nil {
+			errorExit(err)
+		}
+		loginURL := f.LoginURL(token, issuer, destination)
+		if openBrowser {
+			if err := browse(loginURL); err != nil {
+				errorExit(err)
+			}
+			return
+		}
+		printResult(map[string]string{"url": loginURL}, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, loginURL)
+			return err
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(consoleCmd)
+	consoleCmd.Flags().StringVarP(&destination, "destination", "", federation.DefaultDestination, "AWS console URL to open after login")
+	consoleCmd.Flags().StringVarP(&issuer, "issuer", "", "", "URL to go when the console session expires")
+	consoleCmd.Flags().StringVarP(&federationEndpoint, "federation-endpoint", "", federation.DefaultEndpoint, "AWS federation endpoint")
+	consoleCmd.Flags().Int64VarP(&sessionDuration, "session-duration", "", 0, "Console session duration in seconds (default duration of AWS credentials)")
+	consoleCmd.Flags().BoolVarP(&openBrowser, "open", "", false, "Open the login URL in the browser")
+	consoleCmd.Flags().BoolVarP(&force, "force", "", false, "Force refresh AWS credentials if credentials enabled")
+	consoleCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+}
+
+// browse opens the URL in the default browser
+func browse(url string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", url)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		c = exec.Command("xdg-open", url)
+	}
+	return c.Start()
+}
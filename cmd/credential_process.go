@@ -0,0 +1,92 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// ProcessCredentials is the document the AWS SDKs expect from credential_process
+type ProcessCredentials struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string `json:",omitempty"`
+}
+
+// credentialProcessCmd represents the credential-process command
+var credentialProcessCmd = &cobra.Command{
+	Use:   "credential-process",
+	Short: "Print AWS Credentials for credential_process",
+	Long: `Credential-process prints AWS credentials as the JSON document expected by
+credential_process in ~/.aws/config. The credentials are not written to
+~/.aws/credentials, and prompts are written to stderr.
+
+[profile example]
+credential_process = onelogin-aws-connector credential-process --aws-profile example`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		if awsProfile == "" {
+			awsProfile = "default"
+		}
+		promptOutput = os.Stderr
+		creds, err := cached(awsProfile, func() (*sts.Credentials, error) {
+			return authenticate(awsProfile, newInteractiveEvent())
+		})
+		if err != nil {
+			errorExit(err)
+		}
+		output, err := processCredentials(creds)
+		if err != nil {
+			errorExit(err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(output); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(credentialProcessCmd)
+	credentialProcessCmd.Flags().BoolVarP(&force, "force", "", false, "Force refresh AWS credentials if credentials enabled")
+	credentialProcessCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+}
+
+func processCredentials(creds *sts.Credentials) (*ProcessCredentials, error) {
+	if creds == nil || creds.AccessKeyId == nil || creds.SecretAccessKey == nil {
+		return nil, errors.Errorf("AWS credentials are not exists")
+	}
+	output := &ProcessCredentials{
+		Version:         1,
+		AccessKeyID:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+	}
+	if creds.SessionToken != nil {
+		output.SessionToken = *creds.SessionToken
+	}
+	if creds.Expiration != nil {
+		output.Expiration = creds.Expiration.UTC().Format(time.RFC3339)
+	}
+	return output, nil
+}
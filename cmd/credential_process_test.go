@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/daemon"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+)
+
+func TestCredentialProcessCmdProcessCredentials(t *testing.T) {
+	expiration := time.Date(2017, 12, 1, 10, 0, 0, 0, time.UTC)
+	output, err := processCredentials(&sts.Credentials{
+		AccessKeyId:     stringRef("access-key-id"),
+		SecretAccessKey: stringRef("secret-access-key"),
+		SessionToken:    stringRef("session-token"),
+		Expiration:      &expiration,
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	actual := string(data)
+	expected := `{"Version":1,"AccessKeyId":"access-key-id","SecretAccessKey":"secret-access-key","SessionToken":"session-token","Expiration":"2017-12-01T10:00:00Z"}`
+	if actual != expected {
+		t.Errorf("'%v' is not equal '%v'", actual, expected)
+	}
+}
+
+func TestCredentialProcessCmdProcessCredentialsEmpty(t *testing.T) {
+	if _, err := processCredentials(&sts.Credentials{}); err == nil {
+		t.Error("It need to return empty credentials error.")
+	}
+}
+
+func TestCredentialProcessCmdCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir = dir
+	force = false
+
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	creds, err := cached("test", func() (*sts.Credentials, error) {
+		return &sts.Credentials{
+			AccessKeyId:     stringRef("access-key-id"),
+			SecretAccessKey: stringRef("secret-access-key"),
+			SessionToken:    stringRef("session-token"),
+			Expiration:      &expiration,
+		}, nil
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if *creds.AccessKeyId != "access-key-id" {
+		t.Errorf("%s is not equal %s", *creds.AccessKeyId, "access-key-id")
+	}
+
+	creds, err = cached("test", func() (*sts.Credentials, error) {
+		return nil, errors.New("Don't call block function")
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if *creds.SessionToken != "session-token" {
+		t.Errorf("%s is not equal %s", *creds.SessionToken, "session-token")
+	}
+	if !creds.Expiration.Equal(expiration) {
+		t.Errorf("%v is not equal %v", creds.Expiration, expiration)
+	}
+}
+
+func TestCredentialProcessCmdCachedInSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir = dir
+	force = false
+	caches = secret.NewFile(path.Join(dir, "secrets.enc"), func() (string, error) {
+		return "passphrase", nil
+	})
+	defer func() {
+		caches = nil
+	}()
+
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	_, err = cached("test", func() (*sts.Credentials, error) {
+		return &sts.Credentials{
+			AccessKeyId:     stringRef("access-key-id"),
+			SecretAccessKey: stringRef("secret-access-key"),
+			SessionToken:    stringRef("session-token"),
+			Expiration:      &expiration,
+		}, nil
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := os.Stat(cacheFile("test")); !os.IsNotExist(err) {
+		t.Errorf("cache is written to the file: %#v", err)
+	}
+
+	creds, err := cached("test", func() (*sts.Credentials, error) {
+		return nil, errors.New("Don't call block function")
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if *creds.SessionToken != "session-token" {
+		t.Errorf("%s is not equal %s", *creds.SessionToken, "session-token")
+	}
+}
+
+func TestCredentialProcessCmdCachedForce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir = dir
+	original := daemonSocket
+	daemonSocket = path.Join(dir, "daemon.sock")
+	defer func() {
+		daemonSocket = original
+		force = false
+	}()
+	listener, err := net.Listen("unix", daemonSocket)
+	if err != nil {
+		t.Skipf("unix socket is not available: %v", err)
+	}
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	d := daemon.New([]string{"test"}, func(profile string) (*sts.Credentials, error) {
+		return &sts.Credentials{
+			AccessKeyId:     stringRef("daemon-access-key-id"),
+			SecretAccessKey: stringRef("secret-access-key"),
+			SessionToken:    stringRef("session-token"),
+			Expiration:      &expiration,
+		}, nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		return nil, errors.New("Don't call login function")
+	})
+	server := &http.Server{Handler: d}
+	go server.Serve(listener)
+	defer server.Close()
+
+	login := func() (*sts.Credentials, error) {
+		return &sts.Credentials{
+			AccessKeyId:     stringRef("access-key-id"),
+			SecretAccessKey: stringRef("secret-access-key"),
+			SessionToken:    stringRef("session-token"),
+			Expiration:      &expiration,
+		}, nil
+	}
+	force = false
+	creds, err := cached("test", login)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if creds == nil || *creds.AccessKeyId != "daemon-access-key-id" {
+		t.Errorf("%v is not the credentials of the daemon", creds)
+	}
+	// --force logs in even if the daemon has the valid credentials
+	force = true
+	creds, err = cached("test", login)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if creds == nil || *creds.AccessKeyId != "access-key-id" {
+		t.Errorf("%v is not the logged in credentials", creds)
+	}
+}
+
+func stringRef(v string) *string {
+	return &v
+}
@@ -0,0 +1,269 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/daemon"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/password"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+)
+
+var refreshBefore time.Duration
+
+// NotifyEvent answers the login flow without a terminal with OneLogin Protect push notification,
+// or with the MFA token of the OTP source or the registered TOTP key if they are set
+type NotifyEvent struct {
+	OTP      password.Source
+	Registry *totp.Registry
+}
+
+func (m *NotifyEvent) ChooseDeviceIndex(devices []samlassertion.GenerateResponseFactorDevice) (int, error) {
+	if m.OTP != nil {
+		return otpDeviceIndex(m.Registry, devices)
+	}
+	if i, ok := registeredDeviceIndex(m.Registry, devices); ok {
+		return i, nil
+	}
+	for i, device := range devices {
+		if device.DeviceType == samlassertion.NotifyDeviceType {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("OneLogin Protect is not registered as MFA device")
+}
+
+func (m *NotifyEvent) InputMFAToken(device samlassertion.GenerateResponseFactorDevice) (string, error) {
+	if m.OTP != nil {
+		return m.OTP.Password()
+	}
+	if token, ok, err := registeredToken(m.Registry, device); ok || err != nil {
+		return token, err
+	}
+	return "", errors.Errorf("MFA token can not be entered without a terminal")
+}
+
+func (m *NotifyEvent) ChooseRoleIndex(roles []saml.Role) (int, error) {
+	return 0, errors.Errorf("AWS role needs to be configured to login without a terminal")
+}
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Refresh AWS Credentials in background",
+	Long: `Daemon refreshes AWS credentials of the profiles before they expire.
+The login flow is approved with OneLogin Protect push notification, or with
+the MFA token of --otp-source, and the password of each service is read from
+--password-source, password_source of the service or the password stored by
+init --store-password.
+
+Other commands ask the daemon for fresh credentials through
+~/.onelogin-aws-connector/daemon.sock while it is running.`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		promptOutput = os.Stderr
+		targets, err := daemonProfiles(configFile, profiles)
+		if err != nil {
+			errorExit(err)
+		}
+		if err := checkPasswordSources(configFile, targets); err != nil {
+			errorExit(err)
+		}
+		if err := runDaemon(targets); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().StringSliceVarP(&profiles, "profiles", "", nil, "Comma separated aws profile names to refresh (default all profiles)")
+	daemonCmd.Flags().DurationVarP(&refreshBefore, "refresh-before", "", daemon.DefaultRefreshBefore, "Refresh AWS credentials this long before they expire")
+}
+
+// daemonProfiles returns the profiles to refresh, or all profiles if names is empty
+func daemonProfiles(file string, names []string) ([]string, error) {
+	c, err := config.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		for name := range c.App {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if _, ok := c.App[name]; !ok {
+			return nil, errors.Errorf("%s profile is not exists", name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("There is no profile to refresh")
+	}
+	return names, nil
+}
+
+// checkRefreshBefore rejects the refresh duration which is not shorter than half of the session of a profile,
+// because the fresh credentials would be refreshed again at once and the push notifications are flooded.
+func checkRefreshBefore(file string, names []string, before time.Duration) error {
+	if before < 0 {
+		return failure.Errorf(failure.Usage, "--refresh-before %v is negative", before)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+	for _, name := range names {
+		app, ok := c.App[name]
+		if !ok {
+			return failure.Errorf(failure.Config, "%s profile is not exists", name)
+		}
+		if session := credentialsDuration(app); before > session/2 {
+			return failure.Errorf(failure.Usage, "--refresh-before %v needs to be at most half of the session duration %v of %s profile", before, session, name)
+		}
+	}
+	return nil
+}
+
+// checkPasswordSources rejects the profiles whose password would be asked on the terminal
+func checkPasswordSources(file string, names []string) error {
+	for _, name := range names {
+		service, app, err := fetchConfig(file, name)
+		if err != nil {
+			return err
+		}
+		source, err := servicePasswordSource(app.ServiceName(), service)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			return failure.Errorf(failure.Usage, "password of %s service needs --password-source, password_source or init --store-password", app.ServiceName())
+		}
+	}
+	return nil
+}
+
+// credentialsDuration returns the duration of the credentials of the profile, which is of the last chained role if it is chained
+func credentialsDuration(app *config.AppConfig) time.Duration {
+	seconds := app.DurationSeconds
+	if len(app.Chain) > 0 {
+		seconds = app.Chain[len(app.Chain)-1].DurationSeconds
+	}
+	if seconds == 0 {
+		seconds = 3600
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func runDaemon(targets []string) error {
+	if err := checkRefreshBefore(configFile, targets, refreshBefore); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", daemonSocket); err == nil {
+		conn.Close()
+		return errors.Errorf("daemon is already running on %s", daemonSocket)
+	}
+	os.Remove(daemonSocket)
+	listener, err := listenSocket(daemonSocket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(daemonSocket)
+
+	d := daemon.New(targets, func(profile string) (*sts.Credentials, error) {
+		c, err := loadCache(profile)
+		if err != nil {
+			logging.Error("failed to load cache", logging.F("profile", profile), logging.F("error", err))
+		}
+		return c, err
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		creds, err := authenticateWithContext(ctx, profile, &NotifyEvent{OTP: otpSource, Registry: totpRegistry})
+		if err == nil {
+			err = saveCredentials(profile, creds)
+		}
+		if err == nil {
+			err = saveCache(profile, creds)
+		}
+		if err != nil {
+			logging.Error("failed to refresh", logging.F("profile", profile), logging.F("error", err))
+			return nil, err
+		}
+		logging.Info("credentials are refreshed", logging.F("profile", profile), logging.F("expiration", creds.Expiration))
+		return creds, nil
+	})
+	d.RefreshBefore = refreshBefore
+	d.LoginTimeout = loginTimeout
+	if err := d.Validate(); err != nil {
+		listener.Close()
+		return failure.Wrap(failure.Usage, err)
+	}
+
+	server := &http.Server{Handler: d}
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+		server.Close()
+	}()
+	go d.Run(stop)
+	logging.Info("daemon is listening", logging.F("socket", daemonSocket))
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// daemonCredentials asks the running daemon for fresh credentials of the profile
+func daemonCredentials(profile string) (*sts.Credentials, error) {
+	if _, err := os.Stat(daemonSocket); err != nil {
+		return nil, err
+	}
+	return daemon.NewClient(daemonSocket, loginTimeout).Credentials(profile)
+}
+
+// askDaemon returns the credentials of the running daemon, and ok is false if the daemon is not running
+// or does not watch the profile. The daemon waits for its login in progress, and the failure of the login
+// is returned instead of logging in again, so the user is not asked to approve the push notification twice.
+func askDaemon(profile string) (*sts.Credentials, bool, error) {
+	creds, err := daemonCredentials(profile)
+	if err == nil {
+		return creds, true, nil
+	}
+	if e, ok := err.(*daemon.Error); ok && e.StatusCode != http.StatusNotFound {
+		return nil, false, failure.Wrap(failure.Auth, errors.Wrap(err, "daemon failed to login"))
+	}
+	logging.Debug("daemon is not available", logging.F("profile", profile), logging.F("error", err))
+	return nil, false, nil
+}
@@ -0,0 +1,337 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// DefaultRefreshBefore is the default duration to refresh credentials before they expire
+const DefaultRefreshBefore = 5 * time.Minute
+
+// DefaultLoginTimeout is the default deadline of a login including the MFA approval
+const DefaultLoginTimeout = 5 * time.Minute
+
+// Daemon refreshes AWS credentials of the profiles before they expire
+type Daemon struct {
+	Profiles      []string
+	RefreshBefore time.Duration
+	// RetryInterval is the wait after a failed login, which is not longer than MaxInterval
+	RetryInterval time.Duration
+	MaxInterval   time.Duration
+	// LoginTimeout is the deadline of Login, 0 means no deadline
+	LoginTimeout time.Duration
+	// Load returns the cached credentials, or nil if they are expired
+	Load func(profile string) (*sts.Credentials, error)
+	// Login runs the login flow and stores the new credentials
+	Login    func(ctx context.Context, profile string) (*sts.Credentials, error)
+	mu       sync.Mutex
+	status   map[string]*Status
+	inflight map[string]*call
+}
+
+// call is the login in progress, which is shared by the callers of the same profile
+type call struct {
+	done  chan struct{}
+	creds *sts.Credentials
+	err   error
+}
+
+// Status represents the refresh status of a profile
+type Status struct {
+	Profile     string     `json:"profile"`
+	Expiration  *time.Time `json:"expiration,omitempty"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	// retryAt is when the failed login is retried by Run
+	retryAt time.Time
+}
+
+// New creates a Daemon
+func New(profiles []string, load func(string) (*sts.Credentials, error), login func(context.Context, string) (*sts.Credentials, error)) *Daemon {
+	return &Daemon{
+		Profiles:      profiles,
+		RefreshBefore: DefaultRefreshBefore,
+		RetryInterval: 5 * time.Minute,
+		MaxInterval:   10 * time.Minute,
+		LoginTimeout:  DefaultLoginTimeout,
+		Load:          load,
+		Login:         login,
+		status:        map[string]*Status{},
+		inflight:      map[string]*call{},
+	}
+}
+
+// Validate returns the error if the intervals do not work together
+func (d *Daemon) Validate() error {
+	if d.RefreshBefore < 0 {
+		return errors.Errorf("refresh before %v is negative", d.RefreshBefore)
+	}
+	if d.MaxInterval <= 0 || d.RetryInterval <= 0 {
+		return errors.Errorf("retry interval %v and max interval %v need to be positive", d.RetryInterval, d.MaxInterval)
+	}
+	if d.RetryInterval > d.MaxInterval {
+		return errors.Errorf("retry interval %v is longer than max interval %v", d.RetryInterval, d.MaxInterval)
+	}
+	return nil
+}
+
+// Credentials returns credentials of the profile valid for RefreshBefore at least.
+// It can be used as an on-demand refresher without Run.
+// The lock is not held while logging in, and the callers of the same profile wait for the same login.
+func (d *Daemon) Credentials(profile string) (*sts.Credentials, error) {
+	creds, err := d.Load(profile)
+	if err != nil {
+		d.update(profile, nil, err, false)
+		return nil, err
+	}
+	if creds != nil && creds.Expiration != nil && time.Until(*creds.Expiration) >= d.RefreshBefore {
+		d.update(profile, creds, nil, false)
+		return creds, nil
+	}
+	return d.login(profile)
+}
+
+// login runs Login of the profile once even if it is called concurrently
+func (d *Daemon) login(profile string) (*sts.Credentials, error) {
+	d.mu.Lock()
+	if c, ok := d.inflight[profile]; ok {
+		d.mu.Unlock()
+		<-c.done
+		return c.creds, c.err
+	}
+	c := &call{done: make(chan struct{})}
+	d.inflight[profile] = c
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if d.LoginTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), d.LoginTimeout)
+	}
+	c.creds, c.err = d.Login(ctx, profile)
+	cancel()
+	if c.err == nil && c.creds == nil {
+		c.err = errors.Errorf("%s profile is not logged in", profile)
+	}
+
+	d.mu.Lock()
+	delete(d.inflight, profile)
+	d.mu.Unlock()
+	d.update(profile, c.creds, c.err, true)
+	close(c.done)
+	return c.creds, c.err
+}
+
+// update records the result of the profile in the status
+func (d *Daemon) update(profile string, creds *sts.Credentials, err error, refreshed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status, ok := d.status[profile]
+	if !ok {
+		status = &Status{Profile: profile}
+		d.status[profile] = status
+	}
+	if err != nil {
+		status.Error = err.Error()
+		if refreshed {
+			status.retryAt = time.Now().Add(d.RetryInterval)
+		}
+		return
+	}
+	status.retryAt = time.Time{}
+	if refreshed {
+		now := time.Now()
+		status.RefreshedAt = &now
+	}
+	status.Expiration = creds.Expiration
+	status.Error = ""
+}
+
+// Status returns the refresh status of all profiles
+func (d *Daemon) Status() []Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	statuses := make([]Status, 0, len(d.Profiles))
+	for _, profile := range d.Profiles {
+		status, ok := d.status[profile]
+		if !ok {
+			status = &Status{Profile: profile}
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// Run refreshes credentials of the profiles until stop is closed
+func (d *Daemon) Run(stop <-chan struct{}) {
+	for {
+		wait := d.refresh()
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// refresh refreshes all profiles and returns the duration until the next refresh.
+// The profile failed to login is not retried until RetryInterval passes, so the push notifications are not flooded.
+func (d *Daemon) refresh() time.Duration {
+	wait := d.MaxInterval
+	for _, profile := range d.Profiles {
+		if retry := d.retryAfter(profile); retry > 0 {
+			if retry < wait {
+				wait = retry
+			}
+			continue
+		}
+		creds, err := d.Credentials(profile)
+		if err != nil {
+			if d.RetryInterval < wait {
+				wait = d.RetryInterval
+			}
+			continue
+		}
+		if creds.Expiration == nil {
+			continue
+		}
+		next := time.Until(*creds.Expiration) - d.RefreshBefore
+		if next < wait {
+			wait = next
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// retryAfter returns the duration until the failed login of the profile is retried
+func (d *Daemon) retryAfter(profile string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status, ok := d.status[profile]
+	if !ok {
+		return 0
+	}
+	return time.Until(status.retryAt)
+}
+
+// ServeHTTP serves "/status" and "/credentials/<profile>"
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/status":
+		writeJSON(w, http.StatusOK, d.Status())
+	case strings.HasPrefix(r.URL.Path, "/credentials/"):
+		profile := strings.TrimPrefix(r.URL.Path, "/credentials/")
+		if !d.watched(profile) {
+			http.Error(w, profile+" profile is not watched", http.StatusNotFound)
+			return
+		}
+		creds, err := d.Credentials(profile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, creds)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *Daemon) watched(profile string) bool {
+	for _, p := range d.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error is the error response of the daemon
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[%d] %s", e.StatusCode, e.Message)
+}
+
+// Client requests the daemon through the unix socket
+type Client struct {
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client connecting to the socket, which waits for the login of the daemon
+// up to the timeout and a minute more, or without a limit if the timeout is zero
+func NewClient(socket string, timeout time.Duration) *Client {
+	if timeout > 0 {
+		timeout += time.Minute
+	}
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+			// the daemon answers after the login in progress
+			Timeout: timeout,
+		},
+	}
+}
+
+// Credentials returns fresh credentials of the profile
+func (c *Client) Credentials(profile string) (*sts.Credentials, error) {
+	var creds sts.Credentials
+	if err := c.get("/credentials/"+profile, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// Status returns the refresh status of all profiles
+func (c *Client) Status() ([]Status, error) {
+	var statuses []Status
+	if err := c.get("/status", &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	res, err := c.HTTPClient.Get("http://daemon" + path)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
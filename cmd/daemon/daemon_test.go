@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+func createCredentials(accessKeyID string, expiration time.Time) *sts.Credentials {
+	return &sts.Credentials{
+		AccessKeyId:     &accessKeyID,
+		SecretAccessKey: StringRef("secret-access-key"),
+		SessionToken:    StringRef("session-token"),
+		Expiration:      &expiration,
+	}
+}
+
+func TestDaemon_CredentialsUseCache(t *testing.T) {
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return createCredentials("cached", time.Now().Add(time.Hour)), nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		return nil, errors.New("Don't call login function")
+	})
+	creds, err := d.Credentials("default")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if *creds.AccessKeyId != "cached" {
+		t.Errorf("%s is not equal %s", *creds.AccessKeyId, "cached")
+	}
+}
+
+func TestDaemon_CredentialsRefreshBeforeExpiration(t *testing.T) {
+	logins := 0
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return createCredentials("cached", time.Now().Add(time.Minute)), nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		logins++
+		return createCredentials("refreshed", time.Now().Add(time.Hour)), nil
+	})
+	creds, err := d.Credentials("default")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if *creds.AccessKeyId != "refreshed" {
+		t.Errorf("%s is not equal %s", *creds.AccessKeyId, "refreshed")
+	}
+	if logins != 1 {
+		t.Errorf("%d is not equal %d", logins, 1)
+	}
+	statuses := d.Status()
+	if len(statuses) != 1 || statuses[0].RefreshedAt == nil || statuses[0].Error != "" {
+		t.Errorf("%#v is not refreshed status", statuses)
+	}
+}
+
+func TestDaemon_CredentialsLoginError(t *testing.T) {
+	logins := 0
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return nil, nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		logins++
+		return nil, errors.New("login error")
+	})
+	if _, err := d.Credentials("default"); err == nil || err.Error() != "login error" {
+		t.Errorf("%v is not equal 'login error'", err)
+	}
+	statuses := d.Status()
+	if statuses[0].Error != "login error" {
+		t.Errorf("%s is not equal %s", statuses[0].Error, "login error")
+	}
+	// the failed login is not retried until RetryInterval passes
+	if wait := d.refresh(); wait > d.RetryInterval || wait < d.RetryInterval-5*time.Second {
+		t.Errorf("%v is not around %v", wait, d.RetryInterval)
+	}
+	if logins != 1 {
+		t.Errorf("%d is not equal %d", logins, 1)
+	}
+}
+
+func TestDaemon_CredentialsSingleLogin(t *testing.T) {
+	logins := 0
+	started := make(chan struct{})
+	release := make(chan struct{})
+	d := New([]string{"default", "other"}, func(profile string) (*sts.Credentials, error) {
+		if profile == "other" {
+			return createCredentials("other", time.Now().Add(time.Hour)), nil
+		}
+		return nil, nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		logins++
+		close(started)
+		<-release
+		return createCredentials("refreshed", time.Now().Add(time.Hour)), nil
+	})
+	results := make(chan *sts.Credentials, 2)
+	go func() {
+		creds, _ := d.Credentials("default")
+		results <- creds
+	}()
+	<-started
+	go func() {
+		creds, _ := d.Credentials("default")
+		results <- creds
+	}()
+
+	// the other profile and the status are not blocked by the login in progress
+	if creds, err := d.Credentials("other"); err != nil || *creds.AccessKeyId != "other" {
+		t.Errorf("%v, %v is not the cached credentials", creds, err)
+	}
+	if statuses := d.Status(); len(statuses) != 2 {
+		t.Errorf("%#v is not the status of 2 profiles", statuses)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if creds := <-results; creds == nil || *creds.AccessKeyId != "refreshed" {
+			t.Errorf("%v is not the refreshed credentials", creds)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("%d is not equal %d", logins, 1)
+	}
+}
+
+func TestDaemon_CredentialsLoginTimeout(t *testing.T) {
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return nil, nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	d.LoginTimeout = 10 * time.Millisecond
+	if _, err := d.Credentials("default"); err != context.DeadlineExceeded {
+		t.Errorf("%v is not equal %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDaemon_RefreshWithoutExpiration(t *testing.T) {
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return nil, nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		return &sts.Credentials{AccessKeyId: StringRef("refreshed")}, nil
+	})
+	if wait := d.refresh(); wait != d.MaxInterval {
+		t.Errorf("%v is not equal %v", wait, d.MaxInterval)
+	}
+}
+
+func TestDaemon_Validate(t *testing.T) {
+	d := New(nil, nil, nil)
+	if err := d.Validate(); err != nil {
+		t.Errorf("%v", err)
+	}
+	d.RetryInterval = d.MaxInterval + time.Second
+	if err := d.Validate(); err == nil {
+		t.Error("It need to return longer retry interval error.")
+	}
+}
+
+func TestDaemon_Refresh(t *testing.T) {
+	d := New([]string{"default", "other"}, func(profile string) (*sts.Credentials, error) {
+		if profile == "other" {
+			return createCredentials("other", time.Now().Add(5*time.Minute+30*time.Second)), nil
+		}
+		return createCredentials("default", time.Now().Add(time.Hour)), nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		return nil, errors.New("Don't call login function")
+	})
+	wait := d.refresh()
+	if wait > 30*time.Second || wait < 25*time.Second {
+		t.Errorf("%v is not around %v", wait, 30*time.Second)
+	}
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := path.Join(dir, "daemon.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix socket is not available: %v", err)
+	}
+	d := New([]string{"default"}, func(profile string) (*sts.Credentials, error) {
+		return createCredentials("cached", time.Now().Add(time.Hour)), nil
+	}, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		return nil, errors.New("Don't call login function")
+	})
+	server := &http.Server{Handler: d}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := NewClient(socket, DefaultLoginTimeout)
+	creds, err := client.Credentials("default")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if creds != nil && *creds.AccessKeyId != "cached" {
+		t.Errorf("%s is not equal %s", *creds.AccessKeyId, "cached")
+	}
+	statuses, err := client.Status()
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Profile != "default" || statuses[0].Expiration == nil {
+		t.Errorf("%#v is not valid status", statuses)
+	}
+	_, err = client.Credentials("other")
+	if err == nil || err.Error() != "[404] other profile is not watched" {
+		t.Errorf("%v is not equal '[404] other profile is not watched'", err)
+	}
+}
+
+func StringRef(v string) *string {
+	return &v
+}
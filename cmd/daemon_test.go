@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+)
+
+func TestDaemonCmdNotifyEvent(t *testing.T) {
+	event := &NotifyEvent{}
+	selected, err := event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: "OneLogin Protect", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 2 {
+		t.Errorf("%d is not equal %d", selected, 2)
+	}
+	_, err = event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+	})
+	if err == nil {
+		t.Error("It need to return not registered error.")
+	}
+	if _, err := event.InputMFAToken(samlassertion.GenerateResponseFactorDevice{}); err == nil {
+		t.Error("It need to return input error.")
+	}
+}
+
+type SourceMock string
+
+func (s SourceMock) Password() (string, error) {
+	return string(s), nil
+}
+
+func TestDaemonCmdNotifyEventWithOTP(t *testing.T) {
+	event := &NotifyEvent{OTP: SourceMock("123456")}
+	selected, err := event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 1 {
+		t.Errorf("%d is not equal %d", selected, 1)
+	}
+	token, err := event.InputMFAToken(samlassertion.GenerateResponseFactorDevice{})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if token != "123456" {
+		t.Errorf("%s is not equal %s", token, "123456")
+	}
+}
+
+func TestDaemonCmdDaemonProfiles(t *testing.T) {
+	targets, err := daemonProfiles("fixtures/multiaccount.toml", nil)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	expected := "[default other production staging]"
+	if fmt.Sprint(targets) != expected {
+		t.Errorf("%v is not equal %s", targets, expected)
+	}
+	if _, err := daemonProfiles("fixtures/multiaccount.toml", []string{"none"}); err == nil {
+		t.Error("It need to return not exists error.")
+	}
+	if _, err := daemonProfiles("fixtures/serviceconfig.toml", nil); err == nil {
+		t.Error("It need to return no profile error.")
+	}
+}
+
+func TestDaemonCmdCheckRefreshBefore(t *testing.T) {
+	if err := checkRefreshBefore("fixtures/multiaccount.toml", []string{"default", "other"}, 30*time.Minute); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := checkRefreshBefore("fixtures/multiaccount.toml", []string{"default"}, time.Hour); err == nil {
+		t.Error("It need to return longer than the session error.")
+	}
+	// the credentials of the chained role last 900 seconds
+	if err := checkRefreshBefore("fixtures/chainconfig.toml", []string{"default"}, 10*time.Minute); err == nil {
+		t.Error("It need to return longer than the chained session error.")
+	}
+	if err := checkRefreshBefore("fixtures/multiaccount.toml", []string{"default"}, -time.Minute); err == nil {
+		t.Error("It need to return negative error.")
+	}
+}
+
+func TestDaemonCmdCheckPasswordSources(t *testing.T) {
+	secrets = StoreMock{"password": "default-password"}
+	defer func() {
+		secrets = nil
+	}()
+	if err := checkPasswordSources("fixtures/multiservice.toml", []string{"default"}); err != nil {
+		t.Errorf("%#v", err)
+	}
+	// the password of the default service is not sent to the other service
+	if err := checkPasswordSources("fixtures/multiservice.toml", []string{"default", "sandbox"}); err == nil {
+		t.Error("It need to return no password source error.")
+	}
+}
+
+func TestDaemonCmdListenSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := path.Join(dir, "daemon.sock")
+	listener, err := listenSocket(socket)
+	if err != nil {
+		t.Skipf("unix socket is not available: %v", err)
+	}
+	defer listener.Close()
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("%v is not equal %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+)
+
+var envFormat string
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print AWS Credentials as environment variables",
+	Long: `Env prints AWS credentials as statements setting environment variables.
+The credentials are cached, so it is instant while they are valid.
+
+  eval "$(onelogin-aws-connector env --aws-profile example)"
+  onelogin-aws-connector env --aws-profile example --format fish | source
+  onelogin-aws-connector env --aws-profile example --format powershell | Invoke-Expression`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		// --format is rejected before the login even with --output json or yaml
+		if _, err := formatEnvironment(envFormat, nil); err != nil {
+			errorExit(failure.Wrap(failure.Usage, err))
+		}
+		if awsProfile == "" {
+			awsProfile = "default"
+		}
+		promptOutput = os.Stderr
+		variables, err := profileEnvironment(awsProfile)
+		if err != nil {
+			errorExit(err)
+		}
+		// --output json or yaml prints the variables as the object instead of --format
+		values := map[string]string{}
+		for _, v := range variables {
+			values[v.Name] = v.Value
+		}
+		printResult(values, func(w io.Writer) error {
+			output, err := formatEnvironment(envFormat, variables)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(w, output)
+			return err
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(envCmd)
+	envCmd.Flags().StringVarP(&envFormat, "format", "", "bash", "Output format (bash, zsh, fish, powershell or dotenv)")
+	envCmd.Flags().StringVarP(&region, "aws-region", "", "", "AWS Region (default region of aws profile in ~/.aws/config)")
+	envCmd.Flags().BoolVarP(&force, "force", "", false, "Force refresh AWS credentials if credentials enabled")
+	envCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+}
+
+// formatEnvironment returns the statements setting the variables in the format
+func formatEnvironment(format string, variables []environmentVariable) (string, error) {
+	var line func(v environmentVariable) string
+	switch format {
+	case "bash", "zsh", "sh":
+		line = func(v environmentVariable) string {
+			return fmt.Sprintf("export %s=%s\n", v.Name, posixQuote(v.Value))
+		}
+	case "fish":
+		line = func(v environmentVariable) string {
+			return fmt.Sprintf("set -gx %s %s;\n", v.Name, fishQuote(v.Value))
+		}
+	case "powershell":
+		line = func(v environmentVariable) string {
+			return fmt.Sprintf("$Env:%s = %s\n", v.Name, powershellQuote(v.Value))
+		}
+	case "dotenv":
+		line = func(v environmentVariable) string {
+			return fmt.Sprintf("%s=%s\n", v.Name, dotenvQuote(v.Value))
+		}
+	default:
+		return "", errors.Errorf("%s is not supported format", format)
+	}
+	var b strings.Builder
+	for _, v := range variables {
+		b.WriteString(line(v))
+	}
+	return b.String(), nil
+}
+
+func posixQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func fishQuote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, "'", `\'`, -1) + "'"
+}
+
+func powershellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+func dotenvQuote(value string) string {
+	if !strings.ContainsAny(value, " \t\r\n\"'\\#$=") {
+		return value
+	}
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return `"` + value + `"`
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import "testing"
+
+func TestEnvCmdFormatEnvironment(t *testing.T) {
+	variables := []environmentVariable{
+		{Name: "AWS_ACCESS_KEY_ID", Value: "access-key-id"},
+		{Name: "AWS_SESSION_TOKEN", Value: `it's "token"=`},
+	}
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: "bash",
+			want: `export AWS_ACCESS_KEY_ID='access-key-id'
+export AWS_SESSION_TOKEN='it'\''s "token"='
+`,
+		},
+		{
+			format: "fish",
+			want: `set -gx AWS_ACCESS_KEY_ID 'access-key-id';
+set -gx AWS_SESSION_TOKEN 'it\'s "token"=';
+`,
+		},
+		{
+			format: "powershell",
+			want: `$Env:AWS_ACCESS_KEY_ID = 'access-key-id'
+$Env:AWS_SESSION_TOKEN = 'it''s "token"='
+`,
+		},
+		{
+			format: "dotenv",
+			want: `AWS_ACCESS_KEY_ID=access-key-id
+AWS_SESSION_TOKEN="it's \"token\"="
+`,
+		},
+		{
+			format:  "csh",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := formatEnvironment(tt.format, variables)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("formatEnvironment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("'%v' is not equal '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/configuration"
+)
+
+// environmentVariable represents a name and value pair of the environment
+type environmentVariable struct {
+	Name  string
+	Value string
+}
+
+// removedEnvironment is removed from the child environment not to shadow the credentials
+var removedEnvironment = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_EXPIRATION",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+}
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Execute a command with AWS Credentials",
+	Long: `Exec executes the command with AWS credentials in the environment variables.
+The credentials are not written to ~/.aws/credentials.
+
+  onelogin-aws-connector exec --aws-profile example -- terraform plan`,
+	Args:   cobra.MinimumNArgs(1),
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		if awsProfile == "" {
+			awsProfile = "default"
+		}
+		promptOutput = os.Stderr
+		variables, err := profileEnvironment(awsProfile)
+		if err != nil {
+			errorExit(err)
+		}
+		code, err := execute(args, variables)
+		if err != nil {
+			errorExit(err)
+		}
+		os.Exit(code)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(execCmd)
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().StringVarP(&region, "aws-region", "", "", "AWS Region (default region of aws profile in ~/.aws/config)")
+	execCmd.Flags().BoolVarP(&force, "force", "", false, "Force refresh AWS credentials if credentials enabled")
+	execCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+}
+
+// profileEnvironment returns the environment variables of the credentials of the profile
+func profileEnvironment(profile string) ([]environmentVariable, error) {
+	creds, err := cached(profile, func() (*sts.Credentials, error) {
+		return authenticate(profile, newInteractiveEvent())
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := region
+	if r == "" {
+		r, err = configuration.NewConfig(awsDir, profile).Region()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return credentialEnvironment(creds, r), nil
+}
+
+// credentialEnvironment returns the environment variables of the credentials
+func credentialEnvironment(creds *sts.Credentials, region string) []environmentVariable {
+	variables := []environmentVariable{
+		{Name: "AWS_ACCESS_KEY_ID", Value: *creds.AccessKeyId},
+		{Name: "AWS_SECRET_ACCESS_KEY", Value: *creds.SecretAccessKey},
+		{Name: "AWS_SESSION_TOKEN", Value: *creds.SessionToken},
+	}
+	if creds.Expiration != nil {
+		variables = append(variables, environmentVariable{
+			Name:  "AWS_CREDENTIAL_EXPIRATION",
+			Value: creds.Expiration.UTC().Format(time.RFC3339),
+		})
+	}
+	if region != "" {
+		variables = append(variables,
+			environmentVariable{Name: "AWS_REGION", Value: region},
+			environmentVariable{Name: "AWS_DEFAULT_REGION", Value: region},
+		)
+	}
+	return variables
+}
+
+// childEnvironment returns the environment of the parent with the variables
+func childEnvironment(environ []string, variables []environmentVariable) []string {
+	env := []string{}
+	for _, e := range environ {
+		removed := false
+		for _, name := range removedEnvironment {
+			if strings.HasPrefix(e, name+"=") {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			env = append(env, e)
+		}
+	}
+	for _, v := range variables {
+		env = append(env, v.Name+"="+v.Value)
+	}
+	return env
+}
+
+// execute runs the command forwarding signals, and returns its exit code
+func execute(args []string, variables []environmentVariable) (int, error) {
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = childEnvironment(os.Environ(), variables)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	go func() {
+		for s := range signals {
+			c.Process.Signal(s)
+		}
+	}()
+	if err := c.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				if status.Signaled() {
+					return 128 + int(status.Signal()), nil
+				}
+				return status.ExitStatus(), nil
+			}
+			return 1, nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestExecCmdCredentialEnvironment(t *testing.T) {
+	expiration := time.Date(2017, 12, 1, 10, 0, 0, 0, time.UTC)
+	variables := credentialEnvironment(&sts.Credentials{
+		AccessKeyId:     stringRef("access-key-id"),
+		SecretAccessKey: stringRef("secret-access-key"),
+		SessionToken:    stringRef("session-token"),
+		Expiration:      &expiration,
+	}, "ap-northeast-1")
+	actual := fmt.Sprint(variables)
+	expected := "[{AWS_ACCESS_KEY_ID access-key-id} {AWS_SECRET_ACCESS_KEY secret-access-key} {AWS_SESSION_TOKEN session-token} {AWS_CREDENTIAL_EXPIRATION 2017-12-01T10:00:00Z} {AWS_REGION ap-northeast-1} {AWS_DEFAULT_REGION ap-northeast-1}]"
+	if actual != expected {
+		t.Errorf("'%v' is not equal '%v'", actual, expected)
+	}
+}
+
+func TestExecCmdChildEnvironment(t *testing.T) {
+	env := childEnvironment([]string{
+		"PATH=/usr/bin",
+		"AWS_PROFILE=example",
+		"AWS_ACCESS_KEY_ID=old-access-key-id",
+		"AWS_REGION=us-east-1",
+	}, []environmentVariable{
+		{Name: "AWS_ACCESS_KEY_ID", Value: "access-key-id"},
+	})
+	actual := fmt.Sprint(env)
+	expected := "[PATH=/usr/bin AWS_REGION=us-east-1 AWS_ACCESS_KEY_ID=access-key-id]"
+	if actual != expected {
+		t.Errorf("'%v' is not equal '%v'", actual, expected)
+	}
+}
+
+func TestExecCmdExecute(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	code, err := execute([]string{"sh", "-c", `test "$AWS_ACCESS_KEY_ID" = access-key-id && exit 3`}, []environmentVariable{
+		{Name: "AWS_ACCESS_KEY_ID", Value: "access-key-id"},
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if code != 3 {
+		t.Errorf("%d is not equal %d", code, 3)
+	}
+	if _, err := execute([]string{"onelogin-aws-connector-command-not-found"}, nil); err == nil {
+		t.Error("It need to return command not found error.")
+	}
+}
@@ -0,0 +1,129 @@
+package failure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+// Code classifies the errors, so that the wrapper scripts can react to each case
+type Code string
+
+const (
+	// Unknown is the error not classified
+	Unknown Code = "unknown"
+	// Usage is the invalid command line arguments
+	Usage Code = "usage"
+	// Config is the missing or invalid configuration
+	Config Code = "config"
+	// Auth is the authentication failure of OneLogin
+	Auth Code = "onelogin_auth"
+	// MFADenied is the push notification denied on the device
+	MFADenied Code = "mfa_denied"
+	// MFATimeout is the push notification not approved in time
+	MFATimeout Code = "mfa_timeout"
+	// STS is the failure of AWS STS
+	STS Code = "sts"
+	// Timeout is the login not finished in time
+	Timeout Code = "timeout"
+	// Canceled is the login canceled with Ctrl-C
+	Canceled Code = "canceled"
+)
+
+var exitStatuses = map[Code]int{
+	Unknown:    1,
+	Usage:      2,
+	Config:     3,
+	Auth:       4,
+	MFADenied:  5,
+	MFATimeout: 6,
+	STS:        7,
+	Timeout:    8,
+	Canceled:   130,
+}
+
+// ExitStatus returns the exit status of the command failed with the code
+func (c Code) ExitStatus() int {
+	if status, ok := exitStatuses[c]; ok {
+		return status
+	}
+	return exitStatuses[Unknown]
+}
+
+// Error is the error classified with the code
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the classified error for errors.Cause
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the classified error for errors.Is and errors.As
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap classifies the error with the code, and the code already classified is kept
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	if classified(err) != "" {
+		return err
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Errorf returns the error of the message classified with the code
+func Errorf(code Code, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: errors.Errorf(format, args...)}
+}
+
+// CodeOf returns the code of the error.
+// The errors not classified are guessed from the cause.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if c := classified(err); c != "" {
+		return c
+	}
+	cause := errors.Cause(err)
+	switch cause {
+	case context.Canceled:
+		return Canceled
+	case context.DeadlineExceeded:
+		return Timeout
+	}
+	if _, ok := cause.(awserr.Error); ok {
+		return STS
+	}
+	return Unknown
+}
+
+type causer interface {
+	Cause() error
+}
+
+// classified returns the code of the first Error in the causes of the error
+func classified(err error) Code {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e.Code
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return ""
+		}
+		err = c.Cause()
+	}
+	return ""
+}
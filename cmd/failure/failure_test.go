@@ -0,0 +1,57 @@
+package failure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "unknown", err: errors.New("error"), want: Unknown},
+		{name: "classified", err: Wrap(Config, errors.New("error")), want: Config},
+		{name: "wrapped", err: errors.Wrap(Errorf(MFADenied, "denied"), "login"), want: MFADenied},
+		{name: "first code", err: Wrap(Auth, Wrap(MFATimeout, errors.New("error"))), want: MFATimeout},
+		{name: "canceled", err: errors.Wrap(context.Canceled, "login"), want: Canceled},
+		{name: "deadline", err: context.DeadlineExceeded, want: Timeout},
+		{name: "aws", err: errors.Wrap(awserr.New("AccessDenied", "denied", nil), "assume"), want: STS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("%s is not equal %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCode_ExitStatus(t *testing.T) {
+	statuses := map[int]Code{}
+	for code := range exitStatuses {
+		status := code.ExitStatus()
+		if other, ok := statuses[status]; ok {
+			t.Errorf("%s and %s have the same exit status %d", code, other, status)
+		}
+		statuses[status] = code
+	}
+	if Code("other").ExitStatus() != 1 {
+		t.Errorf("%d is not equal %d", Code("other").ExitStatus(), 1)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(Config, nil) != nil {
+		t.Error("It need to return nil.")
+	}
+	err := errors.New("error")
+	if errors.Cause(Wrap(Config, err)) != err {
+		t.Error("It need to keep the cause.")
+	}
+}
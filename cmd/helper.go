@@ -2,10 +2,51 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/output"
 )
 
+// errorDocument is the error printed with --output json or yaml
+type errorDocument struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code       failure.Code `json:"code"`
+	Message    string       `json:"message"`
+	ExitStatus int          `json:"exit_status"`
+}
+
+// errorExit prints the error to stderr and exits with the status of the code.
+// stdout is not used, because the AWS CLI and the SDKs only show stderr of credential-process.
 func errorExit(msg interface{}) {
-	fmt.Println("Error:", msg)
-	os.Exit(-1)
+	err, ok := msg.(error)
+	if !ok {
+		err = errors.New(fmt.Sprint(msg))
+	}
+	code := failure.CodeOf(err)
+	output.Write(os.Stderr, outputFormat, &errorDocument{
+		Error: errorDetail{
+			Code:       code,
+			Message:    err.Error(),
+			ExitStatus: code.ExitStatus(),
+		},
+	}, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "Error:", msg)
+		return err
+	})
+	os.Exit(code.ExitStatus())
+}
+
+// printResult prints the result of the command in the format of --output,
+// and text prints it in the text format
+func printResult(v interface{}, text func(w io.Writer) error) {
+	if err := output.Write(os.Stdout, outputFormat, v, text); err != nil {
+		errorExit(err)
+	}
 }
@@ -16,9 +16,17 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -27,37 +35,102 @@ var clientToken string
 var clientSecret string
 var subdomain string
 var usernameOrEmail string
+var secretStore string
+var cacheEncryption string
+var storePassword bool
+var apiVersion int
+var serviceName string
+var caBundle string
+var stsEndpoint string
+
+// passwordKey is the key of the password stored by --store-password
+const passwordKey = "password"
 
 // initCmd represents the init command
 var initCmd = &cobra.Command{
-	Use:   "init",
-	Short: "Initialize settings for call to onelogin api ",
-	Long:  `Init is initializing settings for onelogin api.`,
+	Use:    "init",
+	Short:  "Initialize settings for call to onelogin api ",
+	Long:   `Init is initializing settings for onelogin api.`,
+	PreRun: openStores,
 	Run: func(cmd *cobra.Command, args []string) {
-		if endpoint != "" {
-			endpoint = fmt.Sprintf("api.%s.onelogin.com", endpoint)
+		var err error
+		if endpoint, err = serviceEndpoint(endpoint); err != nil {
+			errorExit(failure.Wrap(failure.Usage, err))
+		}
+		if err := initServiceConfig(configFile, serviceName); err != nil {
+			errorExit(failure.Wrap(failure.Config, err))
 		}
-		if err := initServiceConfig(configFile, "default"); err != nil {
-			errorExit(err)
+		if storePassword {
+			if err := savePassword(serviceName); err != nil {
+				errorExit(failure.Wrap(failure.Config, err))
+			}
 		}
+		printResult(map[string]string{"service": serviceName}, nil)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(initCmd)
-	initCmd.Flags().StringVarP(&endpoint, "endpoint", "", "", "OneLogin API Server")
+	initCmd.Flags().StringVarP(&serviceName, "service", "", config.DefaultService, "Name of the OneLogin service to initialize")
+	initCmd.Flags().StringVarP(&endpoint, "endpoint", "", "", "OneLogin API Server (us, eu or the base URL such as https://proxy.example.com/onelogin)")
+	initCmd.Flags().StringVarP(&caBundle, "ca-bundle", "", "", "PEM file of CA certificates trusted in addition to the system certificates")
 	initCmd.Flags().StringVarP(&clientToken, "client-token", "", "", "OneLogin API Client Token")
 	initCmd.Flags().StringVarP(&clientSecret, "client-secret", "", "", "OneLogin API Client Secret")
 	initCmd.Flags().StringVarP(&subdomain, "subdomain", "", "", "OneLogin Service Subdomain")
 	initCmd.Flags().StringVarP(&usernameOrEmail, "username-or-email", "", "", "OneLogin Login Username or Email")
+	initCmd.Flags().StringVarP(&secretStore, "secret-store", "", "", "Store of client secret and caches ("+strings.Join(secret.Kinds, ", ")+")")
+	initCmd.Flags().StringVarP(&cacheEncryption, "cache-encryption", "", "", "Encryption of cache files ("+strings.Join(secret.Encryptions, ", ")+")")
+	initCmd.Flags().StringVarP(&stsEndpoint, "sts-endpoint", "", "", "AWS STS endpoint such as http://127.0.0.1:8180/sts of mock-server (\"none\" uses the default endpoint)")
+	initCmd.Flags().IntVarP(&apiVersion, "api-version", "", 0, "Version of OneLogin SAML assertion API (1 or 2)")
+	initCmd.Flags().BoolVarP(&storePassword, "store-password", "", false, "Store OneLogin password in the secret store for --password-source keyring:"+passwordKey+" (keyring:"+passwordKey+".SERVICE for the other services)")
 }
 
-func initServiceConfig(file string, profile string) error {
+func initServiceConfig(file string, name string) error {
 	c, err := config.Load(file)
 	if err != nil {
 		return err
 	}
-	serviceConfig, ok := c.Service[profile]
+	if err := c.UseStore(secrets); err != nil {
+		return err
+	}
+	// the store opened by PreRun is kept unless the kind is changed, so the passphrase is not asked again
+	store := secrets
+	kind := secretStore
+	if kind == "none" {
+		kind = ""
+	}
+	storeChanged := secretStore != "" && kind != c.SecretStore
+	if storeChanged {
+		// the secrets loaded from the current store are moved to the new store by Save
+		store, err = secret.New(kind, path.Dir(file))
+		if err != nil {
+			return err
+		}
+		if err := c.UseStore(store); err != nil {
+			return err
+		}
+		c.SecretStore = kind
+	}
+	encryption := c.CacheEncryption
+	if cacheEncryption != "" {
+		encryption = cacheEncryption
+		if encryption == "none" {
+			encryption = ""
+		}
+	}
+	if encryption != c.CacheEncryption || storeChanged {
+		// the encrypted caches can not be read with the new key, and the plaintext caches are migrated
+		if c.CacheEncryption != "" {
+			if err := removeCaches(cacheDir); err != nil {
+				return err
+			}
+		}
+		if err := openCaches(encryption, store, true); err != nil {
+			return err
+		}
+		c.CacheEncryption = encryption
+	}
+	serviceConfig, ok := c.Service[name]
 	if !ok {
 		serviceConfig = &config.ServiceConfig{}
 	}
@@ -76,12 +149,95 @@ func initServiceConfig(file string, profile string) error {
 	if usernameOrEmail != "" {
 		serviceConfig.UsernameOrEmail = usernameOrEmail
 	}
-	c.Service["default"] = serviceConfig
+	if mfaDevice != "" {
+		serviceConfig.MFADevice = mfaDevice
+	}
+	if caBundle != "" {
+		if caBundle == "none" {
+			serviceConfig.CABundle = ""
+		} else if serviceConfig.CABundle, err = filepath.Abs(caBundle); err != nil {
+			return err
+		}
+	}
+	if stsEndpoint != "" {
+		serviceConfig.STSEndpoint = stsEndpoint
+		if stsEndpoint == "none" {
+			serviceConfig.STSEndpoint = ""
+		}
+	}
+	if apiVersion != 0 {
+		if apiVersion != 1 && apiVersion != 2 {
+			return errors.Errorf("%d is not supported API version", apiVersion)
+		}
+		serviceConfig.APIVersion = apiVersion
+	}
+	c.Service[name] = serviceConfig
 	if err := c.Save(); err != nil {
 		return err
 	}
-	if debug {
-		log.Printf("ServiceConfig: %#v\n", serviceConfig)
+	useSecretStore(store)
+	logging.Debug("service config", logging.F("service", serviceConfig))
+	return nil
+}
+
+// serviceEndpoint returns the endpoint of the region of OneLogin, or the base URL as it is
+func serviceEndpoint(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !strings.Contains(value, "://") {
+		return fmt.Sprintf("api.%s.onelogin.com", value), nil
+	}
+	if err := checkEndpoint(value); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(value, "/"), nil
+}
+
+// checkEndpoint rejects the base URL sending the secrets in plaintext, and the host without the scheme is called with https
+func checkEndpoint(value string) error {
+	if !strings.Contains(value, "://") {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("%s is not supported base URL", value)
+	}
+	// the client secret and the password are sent in plaintext except to the local server such as mock-server
+	if u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		return errors.Errorf("%s needs https except for the loopback address", value)
 	}
 	return nil
 }
+
+// isLoopback tells whether the host is localhost or the loopback address
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// servicePasswordKey returns the key of the password of the service in the secret store
+func servicePasswordKey(name string) string {
+	if name == config.DefaultService {
+		return passwordKey
+	}
+	return fmt.Sprintf("%s.%s", passwordKey, name)
+}
+
+// savePassword stores the password of the service in the secret store initialized by initServiceConfig
+func savePassword(name string) error {
+	if secrets == nil {
+		return errors.Errorf("--store-password requires a secret store")
+	}
+	password, err := readPassword(passwordSource)
+	if err != nil {
+		return err
+	}
+	return secrets.Set(servicePasswordKey(name), password)
+}
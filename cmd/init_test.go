@@ -5,7 +5,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
 )
 
 func TestInitCmdWithoutConfigFile(t *testing.T) {
@@ -96,4 +101,278 @@ func resetInitFlags() {
 	clientSecret = ""
 	subdomain = ""
 	usernameOrEmail = ""
+	secretStore = ""
+	cacheEncryption = ""
+	mfaDevice = ""
+	apiVersion = 0
+	caBundle = ""
+	stsEndpoint = ""
+}
+
+func TestInitCmdWithAPIVersion(t *testing.T) {
+	file := path.Join(os.TempDir(), "example-api-version.toml")
+	defer os.Remove(file)
+
+	resetInitFlags()
+	defer resetInitFlags()
+	endpoint = "api-server"
+	apiVersion = 2
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.Service["default"].APIVersion != 2 {
+		t.Errorf("%d is not equal %d", c.Service["default"].APIVersion, 2)
+	}
+
+	apiVersion = 3
+	if err := initServiceConfig(file, "default"); err == nil {
+		t.Error("It need to return unsupported API version error.")
+	}
+}
+
+func TestServiceEndpoint(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "us", want: "api.us.onelogin.com"},
+		{value: "eu", want: "api.eu.onelogin.com"},
+		{value: "https://proxy.example.com:8443/onelogin/", want: "https://proxy.example.com:8443/onelogin"},
+		{value: "http://127.0.0.1:8080", want: "http://127.0.0.1:8080"},
+		{value: "http://[::1]:8080", want: "http://[::1]:8080"},
+		{value: "http://localhost:8080/onelogin", want: "http://localhost:8080/onelogin"},
+		{value: "http://proxy.example.com/onelogin", wantErr: true},
+		{value: "ftp://127.0.0.1", wantErr: true},
+		{value: "https://", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := serviceEndpoint(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("serviceEndpoint(%s) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s is not equal %s", got, tt.want)
+		}
+	}
+}
+
+func TestInitCmdWithCABundleAndSTSEndpoint(t *testing.T) {
+	file := path.Join(os.TempDir(), "example-ca-bundle.toml")
+	defer os.Remove(file)
+
+	resetInitFlags()
+	defer resetInitFlags()
+	endpoint = "http://127.0.0.1:8080/onelogin"
+	caBundle = "ca-bundle.pem"
+	stsEndpoint = "http://127.0.0.1:8080/sts"
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.Service["default"].Endpoint != endpoint {
+		t.Errorf("%s is not equal %s", c.Service["default"].Endpoint, endpoint)
+	}
+	if c.Service["default"].STSEndpoint != stsEndpoint {
+		t.Errorf("%s is not equal %s", c.Service["default"].STSEndpoint, stsEndpoint)
+	}
+	want, _ := filepath.Abs("ca-bundle.pem")
+	if c.Service["default"].CABundle != want {
+		t.Errorf("%s is not equal %s", c.Service["default"].CABundle, want)
+	}
+
+	caBundle = "none"
+	stsEndpoint = "none"
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err = config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.Service["default"].CABundle != "" {
+		t.Errorf("%s is not empty", c.Service["default"].CABundle)
+	}
+	if c.Service["default"].STSEndpoint != "" {
+		t.Errorf("%s is not empty", c.Service["default"].STSEndpoint)
+	}
+}
+
+func TestInitCmdWithSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "config.toml")
+	cacheDir = dir
+	os.Setenv(secret.PassphraseEnv, "passphrase")
+	defer os.Unsetenv(secret.PassphraseEnv)
+	defer func() {
+		caches = nil
+		onelogin.Store = nil
+		useSecretStore(nil)
+		passwordSource = nil
+	}()
+
+	resetInitFlags()
+	endpoint = "api-server"
+	clientToken = "client-token"
+	clientSecret = "client-secret"
+	subdomain = "subdomain"
+	usernameOrEmail = "username-or-email"
+	secretStore = "file"
+	defer resetInitFlags()
+
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	actual := string(data)
+	expected := `secret_store = "file"
+
+[service]
+  [service.default]
+    endpoint = "api-server"
+    client_token = "client-token"
+    subdomain = "subdomain"
+    username_or_email = "username-or-email"
+
+[app]
+`
+	if actual != expected {
+		t.Errorf("'%v' is not equal '%v'", actual, expected)
+	}
+	value, err := secret.NewFile(path.Join(dir, "secrets.enc"), func() (string, error) {
+		return "passphrase", nil
+	}).Get(config.ClientSecretKey("default"))
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "client-secret" {
+		t.Errorf("%s is not equal %s", value, "client-secret")
+	}
+
+	// --store-password saves the password in the store created by init
+	if _, ok := secrets.(*secret.File); !ok {
+		t.Fatalf("%#v is not the secret file", secrets)
+	}
+	passwordSource = SourceMock("password")
+	if err := savePassword("default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value, err := secrets.Get(passwordKey); err != nil || value != "password" {
+		t.Errorf("%s, %v is not equal %s", value, err, "password")
+	}
+
+	// the store opened by PreRun is kept for the same kind
+	useSecretStore(StoreMock{config.ClientSecretKey("default"): "client-secret"})
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, ok := secrets.(StoreMock); !ok {
+		t.Errorf("%#v is not the opened store", secrets)
+	}
+}
+
+func TestInitCmdWithCacheEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "config.toml")
+	cacheDir = dir
+	if err := ioutil.WriteFile(cacheFile("test"), []byte("plaintext"), 0600); err != nil {
+		t.Errorf("%#v", err)
+	}
+	os.Setenv(secret.PassphraseEnv, "passphrase")
+	defer os.Unsetenv(secret.PassphraseEnv)
+	defer func() {
+		caches = nil
+		onelogin.Store = nil
+	}()
+
+	resetInitFlags()
+	cacheEncryption = "passphrase"
+	defer resetInitFlags()
+
+	if err := initServiceConfig(file, "default"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.CacheEncryption != "passphrase" {
+		t.Errorf("%s is not equal %s", c.CacheEncryption, "passphrase")
+	}
+	data, err := ioutil.ReadFile(cacheFile("test"))
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if string(data) == "plaintext" {
+		t.Error("the plaintext cache is not migrated")
+	}
+	value, err := caches.Get(cacheKey("test"))
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "plaintext" {
+		t.Errorf("%s is not equal %s", value, "plaintext")
+	}
+}
+
+func TestInitCmdWithNamedService(t *testing.T) {
+	source, err := os.Open("fixtures/serviceconfig.toml")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	file := dist.Name()
+	defer os.Remove(file)
+	_, err = io.Copy(dist, source)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+
+	resetInitFlags()
+	defer resetInitFlags()
+	endpoint = "sandbox-api-server"
+	clientToken = "sandbox-client-token"
+	clientSecret = "sandbox-client-secret"
+	subdomain = "sandbox-subdomain"
+	usernameOrEmail = "sandbox-username-or-email"
+	if err := initServiceConfig(file, "sandbox"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	c, err := config.Load(file)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if c.Service["default"].Endpoint != "api-server" {
+		t.Errorf("%s is not equal %s", c.Service["default"].Endpoint, "api-server")
+	}
+	if c.Service["sandbox"].Endpoint != "sandbox-api-server" {
+		t.Errorf("%s is not equal %s", c.Service["sandbox"].Endpoint, "sandbox-api-server")
+	}
+	if servicePasswordKey("sandbox") != "password.sandbox" || servicePasswordKey("default") != "password" {
+		t.Errorf("%s and %s are not the password keys", servicePasswordKey("sandbox"), servicePasswordKey("default"))
+	}
 }
@@ -16,10 +16,14 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -32,42 +36,118 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/lifull-dev/onelogin-aws-connector/aws/configuration"
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
 	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
 	"github.com/lifull-dev/onelogin-aws-connector/cmd/login"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/password"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/tui"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
 )
 
 var region string
 var force bool
+var role string
+var all bool
+var profiles []string
+var loginTimeout time.Duration
+var requestTimeout time.Duration
+
+// promptOutput is where interactive prompts are written
+var promptOutput io.Writer = os.Stdout
+
+// stdin is the buffered standard input shared by the prompts, so the input buffered by one prompt is not lost to the others
+var stdin = bufio.NewReader(os.Stdin)
+
+// passwordSource provides the password instead of the terminal if set
+var passwordSource password.Source
+
+// otpSource provides the MFA token instead of the terminal if set
+var otpSource password.Source
+
+// approvalTimeout is how long the push notification is polled for the approval
+var approvalTimeout = samlassertion.DefaultApprovalTimeout
 
 type LoginEvent struct {
-	reader *bufio.Reader
+	reader   *bufio.Reader
+	otp      password.Source
+	registry *totp.Registry
+	// ui asks with the terminal UI instead of the plain prompts if set
+	ui *tui.UI
 }
 
 func NewLoginEvent(reader *bufio.Reader) *LoginEvent {
 	return &LoginEvent{
-		reader: reader,
+		reader:   reader,
+		otp:      otpSource,
+		registry: totpRegistry,
+	}
+}
+
+// newInteractiveEvent creates a LoginEvent asking with the terminal UI if the prompts are shown on a terminal
+func newInteractiveEvent() *LoginEvent {
+	event := NewLoginEvent(stdin)
+	event.ui = terminalUI()
+	return event
+}
+
+// terminalUI returns the terminal UI, or nil if stdin or the prompt output is not a terminal
+func terminalUI() *tui.UI {
+	out, ok := promptOutput.(*os.File)
+	if !ok || !tui.IsTerminal(os.Stdin) || !tui.IsTerminal(out) {
+		return nil
 	}
+	return tui.New(os.Stdin, stdin, out)
 }
 
 func (m *LoginEvent) ChooseDeviceIndex(devices []samlassertion.GenerateResponseFactorDevice) (int, error) {
-	if debug {
-		fmt.Println("")
-		log.Println("MFA Devices:")
-		for _, device := range devices {
-			log.Printf("  %v:\t\t%v\n", device.DeviceID, device.DeviceType)
-		}
+	for _, device := range devices {
+		logging.Debug("MFA device", logging.F("DeviceID", device.DeviceID), logging.F("DeviceType", device.DeviceType))
+	}
+	if m.otp != nil {
+		return otpDeviceIndex(m.registry, devices)
+	}
+	items := make([]string, len(devices))
+	for i, device := range devices {
+		items[i] = device.DeviceType
+	}
+	return m.choose("Select your MFA device: ", items)
+}
+
+func (m *LoginEvent) ChooseRoleIndex(roles []saml.Role) (int, error) {
+	items := make([]string, len(roles))
+	for i, role := range roles {
+		items[i] = role.RoleArn
+	}
+	return m.choose("Select your AWS role: ", items)
+}
+
+// promptError exits with the canceled status when the prompt is interrupted with Ctrl-C or ESC
+func promptError(err error) error {
+	if err == tui.ErrInterrupted {
+		return failure.Wrap(failure.Canceled, err)
+	}
+	return err
+}
+
+func (m *LoginEvent) choose(message string, items []string) (int, error) {
+	if m.ui != nil {
+		selected, err := m.ui.Select(message, items)
+		return selected, promptError(err)
 	}
-	length := len(devices)
+	length := len(items)
 	selected := length
 	for {
-		fmt.Println("--------")
-		for i, device := range devices {
-			fmt.Printf("%d : %s\n", i, device.DeviceType)
+		fmt.Fprintln(promptOutput, "--------")
+		for i, item := range items {
+			fmt.Fprintf(promptOutput, "%d : %s\n", i, item)
 		}
-		fmt.Println("--------")
-		fmt.Print("Select your MFA device: ")
+		fmt.Fprintln(promptOutput, "--------")
+		fmt.Fprint(promptOutput, message)
 		tmp, err := m.reader.ReadString('\n')
 		if err != nil {
 			return 0, err
@@ -87,11 +167,27 @@ func (m *LoginEvent) ChooseDeviceIndex(devices []samlassertion.GenerateResponseF
 	return selected, nil
 }
 
-func (m *LoginEvent) InputMFAToken() (string, error) {
+func (m *LoginEvent) InputMFAToken(device samlassertion.GenerateResponseFactorDevice) (string, error) {
+	if m.otp != nil {
+		return m.otp.Password()
+	}
+	if token, ok, err := registeredToken(m.registry, device); ok || err != nil {
+		return token, err
+	}
 	var token string
 	var err error
 	for {
-		fmt.Print("Enter your MFA token: ")
+		if m.ui != nil {
+			token, err = m.ui.Input("Enter your MFA token: ", false)
+			if err != nil {
+				return "", promptError(err)
+			}
+			if token != "" {
+				break
+			}
+			continue
+		}
+		fmt.Fprint(promptOutput, "Enter your MFA token: ")
 		token, err = m.reader.ReadString('\n')
 		if err != nil {
 			return "", err
@@ -104,135 +200,139 @@ func (m *LoginEvent) InputMFAToken() (string, error) {
 	return token, nil
 }
 
+// WaitForApproval shows the spinner with the countdown of the timeout while the push notification is not approved
+func (m *LoginEvent) WaitForApproval(device samlassertion.GenerateResponseFactorDevice, timeout time.Duration) func() {
+	if m.ui == nil {
+		return func() {}
+	}
+	return m.ui.Spin(fmt.Sprintf("Waiting for approval on %s", device.DeviceType), timeout)
+}
+
+// otpDeviceIndex returns the MFA device answered with the MFA token of the OTP source.
+// It is called when the preference of --mfa-device does not match, so the device is the one whose TOTP key
+// is registered, or the only device requiring the token. The token is not sent to a guessed device,
+// because every device of the API v1 requires it and a wrong token burns the MFA attempt.
+func otpDeviceIndex(registry *totp.Registry, devices []samlassertion.GenerateResponseFactorDevice) (int, error) {
+	if i, ok := registeredDeviceIndex(registry, devices); ok {
+		return i, nil
+	}
+	matched := []int{}
+	types := []string{}
+	for i, device := range devices {
+		if device.RequireOTPToken {
+			matched = append(matched, i)
+			types = append(types, device.DeviceType)
+		}
+	}
+	if len(matched) == 1 {
+		return matched[0], nil
+	}
+	if len(matched) == 0 {
+		return 0, failure.Errorf(failure.Config, "there is no MFA device answered with the token of --otp-source")
+	}
+	return 0, failure.Errorf(failure.Usage, "MFA device of --otp-source is one of %s, select it with --mfa-device", strings.Join(types, ", "))
+}
+
 // loginCmd represents the login command
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login to AWS with OneLogin",
-	Long:  `Login is CLI Command to Create AWS Credentials with OneLogin`,
+	Long: `Login is CLI Command to Create AWS Credentials with OneLogin
+
+With --all or --profiles, the profiles sharing the same OneLogin AppID and
+service are logged in with a single password and MFA verification.`,
+	PreRun: openStores,
 	Run: func(cmd *cobra.Command, args []string) {
 		if awsProfile == "" {
 			awsProfile = "default"
 		}
-		err := cached(awsProfile, func() (*sts.Credentials, error) {
-			service, app, err := fetchConfig(configFile, awsProfile)
-			if err != nil {
-				return nil, err
+		if all || len(profiles) > 0 {
+			if role != "" {
+				errorExit(failure.Errorf(failure.Usage, "--role can not be used with --all or --profiles"))
 			}
-			if debug {
-				log.Println("OneLogin Configuration:")
-				log.Printf("  Endpoint:\t\t%v\n", service.Endpoint)
-				log.Printf("  ClientToken:\t\t%v\n", service.ClientToken)
-				log.Printf("  ClientSecret:\t%v\n", service.ClientSecret)
-			}
-
-			onelogin.CacheDir = cacheDir
-			config := onelogin.NewConfig(service.Endpoint, service.ClientToken, service.ClientSecret)
-			if force {
-				config.Credentials.Credentials = nil
-			}
-			if err := config.Save(); err != nil {
-				return nil, err
-			}
-			if debug {
-				creds, _ := config.Credentials.Get()
-				log.Println("OneLogin Credentials:")
-				log.Printf("  AccessToken:\t\t%v\n", creds.AccessToken)
-				log.Printf("  RefreshToken:\t%v\n", creds.RefreshToken)
-				log.Printf("  CreatedAt:\t\t%v\n", creds.CreatedAt)
-				log.Printf("  AccessExpiresAt:\t%v\n", creds.AccessExpiresAt)
-				log.Printf("  RefreshExpiresAt:\t%v\n", creds.RefreshExpiresAt)
-			}
-
-			fmt.Print("Enter your password: ")
-			tmp, err := terminal.ReadPassword(int(syscall.Stdin))
+			targets, err := batchProfiles(configFile, awsProfile, all, profiles)
 			if err != nil {
-				return nil, err
-			}
-			password := string(tmp)
-			fmt.Println("")
-			duration := app.DurationSeconds
-			if duration == 0 {
-				duration = 3600
+				errorExit(err)
 			}
-			if debug {
-				fmt.Println("")
-				log.Println("Login Parameters:")
-				log.Printf("  Subdomain:\t\t%v\n", service.Subdomain)
-				log.Printf("  AppID:\t\t%v\n", app.AppID)
-				log.Printf("  UsernameOrEmail:\t%v\n", service.UsernameOrEmail)
-				log.Printf("  Password:\t\t%v\n", password)
-				log.Printf("  PrincipalArn:\t%v\n", app.PrincipalArn)
-				log.Printf("  RoleArn:\t\t%v\n", app.RoleArn)
-				log.Printf("  DurationSeconds:\t%v\n", duration)
-			}
-			l := login.New(config, &login.Parameters{
-				UsernameOrEmail: service.UsernameOrEmail,
-				Password:        password,
-				AppID:           app.AppID,
-				Subdomain:       service.Subdomain,
-				PrincipalArn:    app.PrincipalArn,
-				RoleArn:         app.RoleArn,
-				DurationSeconds: duration,
-			})
-			creds, err := l.Login(NewLoginEvent(bufio.NewReader(os.Stdin)))
-
+			results, err := loginAll(targets)
 			if err != nil {
-				return nil, err
-			}
-
-			if debug {
-				log.Println("AWS Credentials:")
-				log.Printf("  AccessKeyId:\t%v\n", *creds.AccessKeyId)
-				log.Printf("  SecretAccessKey:\t%v\n", *creds.SecretAccessKey)
-				log.Printf("  SessionToken:\t%v\n", *creds.SessionToken)
-				log.Printf("  Expiration:\t\t%v\n", creds.Expiration)
+				errorExit(err)
 			}
-			options := map[string]string{
-				"aws_access_key_id":     *creds.AccessKeyId,
-				"aws_secret_access_key": *creds.SecretAccessKey,
-				"aws_session_token":     *creds.SessionToken,
-			}
-			awsCredentials := configuration.NewCredentials(awsDir, awsProfile)
-			err = awsCredentials.Save(options)
-			if err != nil {
-				return nil, err
-			}
-			if region != "" {
-				awsConfig := configuration.NewConfig(awsDir, awsProfile)
-				err = awsConfig.Save(region)
-				if err != nil {
-					return nil, err
-				}
-			}
-			return creds, nil
+			printLoginResult(targets, results)
+			return
+		}
+		creds, err := cached(awsProfile, func() (*sts.Credentials, error) {
+			return authenticate(awsProfile, newInteractiveEvent())
 		})
 		if err != nil {
 			errorExit(err)
 		}
+		// the credentials of the cache and the daemon are written as well as the logged in credentials
+		if err := saveCredentials(awsProfile, creds); err != nil {
+			errorExit(err)
+		}
+		printLoginResult([]string{awsProfile}, map[string]*sts.Credentials{awsProfile: creds})
 	},
 }
 
+// loginResult is the result of login printed with --output json or yaml
+type loginResult struct {
+	Profiles []loginProfile `json:"profiles"`
+}
+
+type loginProfile struct {
+	Profile    string     `json:"profile"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+}
+
+// printLoginResult prints the expiration of the credentials of the profiles,
+// and login prints nothing in the text format as before
+func printLoginResult(profiles []string, results map[string]*sts.Credentials) {
+	r := loginResult{Profiles: []loginProfile{}}
+	for _, profile := range profiles {
+		p := loginProfile{Profile: profile}
+		if creds, ok := results[profile]; ok && creds != nil {
+			p.Expiration = creds.Expiration
+		}
+		r.Profiles = append(r.Profiles, p)
+	}
+	printResult(&r, nil)
+}
+
 func init() {
 	RootCmd.AddCommand(loginCmd)
 	loginCmd.Flags().StringVarP(&region, "aws-region", "", "", "AWS Region")
 	loginCmd.Flags().BoolVarP(&force, "force", "", false, "Force refresh AWS credentials if credentials enabled")
+	loginCmd.Flags().StringVarP(&role, "role", "", "", "AWS Role ARN or name to select from the roles in SAML Response")
+	loginCmd.Flags().BoolVarP(&all, "all", "", false, "Login to all profiles sharing the AppID of aws profile")
+	loginCmd.Flags().StringSliceVarP(&profiles, "profiles", "", nil, "Comma separated aws profile names sharing the same AppID")
 	loginCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+	loginCmd.Flags().DurationVarP(&approvalTimeout, "approval-timeout", "", approvalTimeout, "Deadline of the push notification approval")
 }
 
 func fetchConfig(file string, profile string) (config.ServiceConfig, config.AppConfig, error) {
 	c, err := config.Load(file)
 	if err != nil {
-		return config.ServiceConfig{}, config.AppConfig{}, err
+		return config.ServiceConfig{}, config.AppConfig{}, failure.Wrap(failure.Config, err)
+	}
+	if err := c.UseStore(secrets); err != nil {
+		return config.ServiceConfig{}, config.AppConfig{}, failure.Wrap(failure.Config, err)
 	}
 	app, ok := c.App[profile]
 	if !ok {
 		return emptyConfig(fmt.Sprintf("%s profile is not exists", profile))
 	}
 
-	service := c.Service["default"]
+	service, ok := c.Service[app.ServiceName()]
+	if !ok {
+		return emptyConfig(fmt.Sprintf("%s service is not exists", app.ServiceName()))
+	}
 	if service.Endpoint == "" {
 		return emptyConfig("Endpoint is not exists")
 	}
+	if err := checkEndpoint(service.Endpoint); err != nil {
+		return config.ServiceConfig{}, config.AppConfig{}, failure.Wrap(failure.Config, err)
+	}
 
 	if service.ClientToken == "" {
 		return emptyConfig("ClientToken is not exists")
@@ -245,47 +345,454 @@ func fetchConfig(file string, profile string) (config.ServiceConfig, config.AppC
 	if service.Subdomain == "" {
 		return emptyConfig("Subdomain is not exists")
 	}
+
+	if service.APIVersion != 0 && service.APIVersion != 1 && service.APIVersion != 2 {
+		return emptyConfig(fmt.Sprintf("%d is not supported api_version", service.APIVersion))
+	}
 	return *service, *app, nil
 }
 
-func emptyConfig(message string) (config.ServiceConfig, config.AppConfig, error) {
-	return config.ServiceConfig{}, config.AppConfig{}, errors.Errorf(message)
+// batchProfiles returns the profiles to login with a single SAML assertion
+func batchProfiles(file string, profile string, all bool, names []string) ([]string, error) {
+	c, err := config.Load(file)
+	if err != nil {
+		return nil, failure.Wrap(failure.Config, err)
+	}
+	if all {
+		base, ok := c.App[profile]
+		if !ok {
+			return nil, failure.Errorf(failure.Config, "%s profile is not exists", profile)
+		}
+		names = []string{}
+		for name, app := range c.App {
+			if app.AppID == base.AppID && app.ServiceName() == base.ServiceName() {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	var appID string
+	var service string
+	targets := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		app, ok := c.App[name]
+		if !ok {
+			return nil, failure.Errorf(failure.Config, "%s profile is not exists", name)
+		}
+		if appID == "" {
+			appID = app.AppID
+			service = app.ServiceName()
+		}
+		if app.AppID != appID {
+			return nil, failure.Errorf(failure.Config, "%s profile does not share AppID %s", name, appID)
+		}
+		if app.ServiceName() != service {
+			return nil, failure.Errorf(failure.Config, "%s profile does not share service %s", name, service)
+		}
+		targets = append(targets, name)
+	}
+	if len(targets) == 0 {
+		return nil, failure.Errorf(failure.Config, "There is no profile to login")
+	}
+	return targets, nil
 }
 
-func cached(profile string, block func() (*sts.Credentials, error)) error {
-	file := path.Join(cacheDir, fmt.Sprintf("aws.%s.cache", profile))
-	if !force {
-		var c *sts.Credentials
-		if _, err := toml.DecodeFile(file, &c); err != nil {
-			if err != nil {
-				if !os.IsNotExist(err) {
-					return err
-				}
-			}
-		} else {
-			if c.Expiration != nil {
-				now := time.Now()
-				if now.Before(*c.Expiration) {
-					if debug {
-						log.Println("use aws credentials cache")
-					}
-					return nil
-				}
+// authenticate runs the OneLogin login flow for the profile and returns
+// the assumed role credentials without persisting them anywhere.
+func authenticate(profile string, event login.Event) (*sts.Credentials, error) {
+	return authenticateWithContext(context.Background(), profile, event)
+}
+
+// authenticateWithContext is authenticate canceled with the context
+func authenticateWithContext(parent context.Context, profile string, event login.Event) (*sts.Credentials, error) {
+	service, app, err := fetchConfig(configFile, profile)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := loginContext(parent)
+	defer cancel()
+	l, err := newLogin(ctx, service, app)
+	if err != nil {
+		return nil, loginError(ctx, err)
+	}
+	creds, err := l.LoginWithContext(ctx, event)
+	if err != nil {
+		return nil, loginError(ctx, err)
+	}
+	debugCredentials(creds)
+	return creds, nil
+}
+
+// authenticateAll obtains a SAML assertion once and assumes the role of every profile.
+// The credentials of the succeeded profiles are returned even if some profiles failed.
+func authenticateAll(profiles []string) (map[string]*sts.Credentials, error) {
+	service, app, err := fetchConfig(configFile, profiles[0])
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := loginContext(context.Background())
+	defer cancel()
+	l, err := newLogin(ctx, service, app)
+	if err != nil {
+		return nil, loginError(ctx, err)
+	}
+	event := newInteractiveEvent()
+	SAML, err := l.AssertionWithContext(ctx, event)
+	if err != nil {
+		return nil, loginError(ctx, err)
+	}
+	results := map[string]*sts.Credentials{}
+	failed := []string{}
+	var firstErr error
+	for _, profile := range profiles {
+		service, app, err := fetchConfig(configFile, profile)
+		if err == nil {
+			var creds *sts.Credentials
+			creds, err = l.AssumeRoleWithContext(ctx, SAML, loginParameters(service, app), event)
+			err = loginError(ctx, err)
+			if err == nil {
+				debugCredentials(creds)
+				results[profile] = creds
+				continue
 			}
 		}
+		logging.Error("failed to login", logging.F("profile", profile), logging.F("error", err))
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed = append(failed, profile)
 	}
-	c, err := block()
+	if len(failed) > 0 {
+		// the code of the first failure tells the cause to the wrapper scripts
+		return results, failure.Wrap(failure.CodeOf(firstErr), errors.Errorf("failed to login %s", strings.Join(failed, ", ")))
+	}
+	return results, nil
+}
+
+// loginContext returns the context canceled with Ctrl-C, the parent or when the login timeout expires
+func loginContext(parent context.Context) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if loginTimeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, loginTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// the signals are caught only once, so a second Ctrl-C exits even while a prompt is waiting
+		defer signal.Stop(signals)
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// loginError explains the error caused by the canceled context
+func loginError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch ctx.Err() {
+	case context.Canceled:
+		return failure.Errorf(failure.Canceled, "login is canceled")
+	case context.DeadlineExceeded:
+		if loginTimeout == 0 {
+			return failure.Errorf(failure.Timeout, "login is timed out")
+		}
+		return failure.Errorf(failure.Timeout, "login is timed out after %v", loginTimeout)
+	}
+	return err
+}
+
+// loginAll logs in the profiles whose cached credentials are expired
+func loginAll(profiles []string) (map[string]*sts.Credentials, error) {
+	logged := map[string]*sts.Credentials{}
+	expired := []string{}
+	for _, profile := range profiles {
+		c, err := loadCache(profile)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			expired = append(expired, profile)
+			continue
+		}
+		logged[profile] = c
+	}
+	if len(expired) == 0 {
+		logging.Debug("use aws credentials cache", logging.F("profiles", profiles))
+		return logged, nil
+	}
+	results, loginErr := authenticateAll(expired)
+	for _, profile := range expired {
+		creds, ok := results[profile]
+		if !ok {
+			continue
+		}
+		if err := saveCredentials(profile, creds); err != nil {
+			return nil, err
+		}
+		if err := saveCache(profile, creds); err != nil {
+			return nil, err
+		}
+		logged[profile] = creds
+	}
+	return logged, loginErr
+}
+
+// newLogin prepares OneLogin API credentials and asks the password
+func newLogin(ctx context.Context, service config.ServiceConfig, app config.AppConfig) (*login.Login, error) {
+	logging.Debug("OneLogin configuration",
+		logging.F("Endpoint", service.Endpoint),
+		logging.F("ClientToken", service.ClientToken),
+		logging.F("ClientSecret", service.ClientSecret),
+		logging.F("CABundle", service.CABundle),
+	)
+
+	onelogin.CacheDir = cacheDir
+	config := onelogin.NewConfig(service.Endpoint, service.ClientToken, service.ClientSecret)
+	config.HTTPClient.Timeout = requestTimeout
+	if service.CABundle != "" {
+		if err := config.UseCABundle(service.CABundle); err != nil {
+			return nil, failure.Wrap(failure.Config, err)
+		}
+	}
+	if force {
+		config.Credentials.Credentials = nil
+	}
+	if err := config.SaveWithContext(ctx); err != nil {
+		return nil, failure.Wrap(failure.Auth, err)
+	}
+	if logging.Enabled(logging.DebugLevel) {
+		creds, _ := config.Credentials.Get()
+		logging.Debug("OneLogin credentials", logging.F("credentials", creds))
+	}
+
+	source, err := servicePasswordSource(app.ServiceName(), service)
 	if err != nil {
+		return nil, err
+	}
+	password, err := readPassword(source)
+	if err != nil {
+		return nil, err
+	}
+	params := loginParameters(service, app)
+	params.Password = password
+	logging.Debug("login parameters", logging.F("parameters", params))
+	return login.New(config, params), nil
+}
+
+// servicePasswordSource returns the password source of the service, which is --password-source, password_source
+// of the service, or the password stored by init --store-password. It is nil if the password is asked on the terminal.
+func servicePasswordSource(name string, service config.ServiceConfig) (password.Source, error) {
+	if passwordSource != nil {
+		return passwordSource, nil
+	}
+	if service.PasswordSource != "" {
+		source, err := password.Parse(service.PasswordSource)
+		if err != nil {
+			return nil, failure.Wrap(failure.Config, errors.Wrapf(err, "password_source of %s service", name))
+		}
+		return source, nil
+	}
+	if secrets == nil {
+		return nil, nil
+	}
+	key := servicePasswordKey(name)
+	if _, err := secrets.Get(key); err != nil {
+		if err == secret.ErrNotFound {
+			return nil, nil
+		}
+		return nil, failure.Wrap(failure.Config, err)
+	}
+	return password.Keyring(key), nil
+}
+
+// readPassword returns the password from the source, or asks it on the terminal if the source is nil
+func readPassword(source password.Source) (string, error) {
+	if source != nil {
+		return source.Password()
+	}
+	if ui := terminalUI(); ui != nil {
+		password, err := ui.Input("Enter your password: ", true)
+		return password, promptError(err)
+	}
+	fmt.Fprint(promptOutput, "Enter your password: ")
+	tmp, err := terminal.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(promptOutput, "")
+	return string(tmp), nil
+}
+
+func loginParameters(service config.ServiceConfig, app config.AppConfig) *login.Parameters {
+	duration := app.DurationSeconds
+	if duration == 0 {
+		duration = 3600
+	}
+	chain := []login.ChainedRole{}
+	for _, c := range app.Chain {
+		chain = append(chain, login.ChainedRole{
+			RoleArn:         c.RoleArn,
+			ExternalID:      c.ExternalID,
+			SessionName:     c.SessionName,
+			DurationSeconds: c.DurationSeconds,
+		})
+	}
+	// the flag is preferred to the profile, and the profile is preferred to the service
+	device := mfaDevice
+	if device == "" {
+		device = app.MFADevice
+	}
+	if device == "" {
+		device = service.MFADevice
+	}
+	return &login.Parameters{
+		UsernameOrEmail: service.UsernameOrEmail,
+		AppID:           app.AppID,
+		Subdomain:       service.Subdomain,
+		PrincipalArn:    app.PrincipalArn,
+		RoleArn:         app.RoleArn,
+		RoleMatch:       role,
+		DurationSeconds: duration,
+		Chain:           chain,
+		MFADevice:       device,
+		ApprovalTimeout: approvalTimeout,
+		APIVersion:      service.APIVersion,
+		STSEndpoint:     service.STSEndpoint,
+	}
+}
+
+func debugCredentials(creds *sts.Credentials) {
+	logging.Debug("AWS credentials", logging.F("credentials", creds))
+}
+
+// saveCredentials writes the credentials to ~/.aws/credentials and the region to ~/.aws/config
+func saveCredentials(profile string, creds *sts.Credentials) error {
+	options := map[string]string{
+		"aws_access_key_id":     *creds.AccessKeyId,
+		"aws_secret_access_key": *creds.SecretAccessKey,
+		"aws_session_token":     *creds.SessionToken,
+	}
+	awsCredentials := configuration.NewCredentials(awsDir, profile)
+	if err := awsCredentials.Save(options); err != nil {
 		return err
 	}
-	fd, err := os.Create(file)
+	if region != "" {
+		awsConfig := configuration.NewConfig(awsDir, profile)
+		if err := awsConfig.Save(region); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emptyConfig(message string) (config.ServiceConfig, config.AppConfig, error) {
+	return config.ServiceConfig{}, config.AppConfig{}, failure.Errorf(failure.Config, message)
+}
+
+// cached returns the cached credentials or the credentials of the daemon, or calls the block to login.
+// --force always logs in, because the daemon returns its valid credentials.
+func cached(profile string, block func() (*sts.Credentials, error)) (*sts.Credentials, error) {
+	// the cache does not remember the role, so an explicit role always logs in again
+	if role == "" && !force {
+		c, err := loadCache(profile)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			logging.Debug("use aws credentials cache", logging.F("profile", profile))
+			return c, nil
+		}
+		c, ok, err := askDaemon(profile)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logging.Debug("use aws credentials of daemon", logging.F("profile", profile))
+			return c, nil
+		}
+	}
+	c, err := block()
+	if err != nil {
+		return nil, err
+	}
+	if err := saveCache(profile, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadCache returns the cached credentials of the profile, or nil if they are expired
+func loadCache(profile string) (*sts.Credentials, error) {
+	if force {
+		return nil, nil
+	}
+	c, err := readCache(profile)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	if c.Expiration == nil || !time.Now().Before(*c.Expiration) {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// readCache returns the cached credentials of the profile even if they are expired, or nil if there is no cache
+func readCache(profile string) (*sts.Credentials, error) {
+	var c *sts.Credentials
+	if caches != nil {
+		data, err := caches.Get(cacheKey(profile))
+		if err != nil {
+			if err != secret.ErrNotFound {
+				return nil, err
+			}
+			return nil, nil
+		}
+		if _, err := toml.Decode(data, &c); err != nil {
+			return nil, err
+		}
+	} else if _, err := toml.DecodeFile(cacheFile(profile), &c); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return c, nil
+}
+
+func saveCache(profile string, c *sts.Credentials) error {
+	if caches != nil {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+			return err
+		}
+		return caches.Set(cacheKey(profile), buf.String())
+	}
+	fd, err := os.Create(cacheFile(profile))
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
 	encoder := toml.NewEncoder(fd)
-	if err := encoder.Encode(c); err != nil {
-		return err
-	}
-	return nil
+	return encoder.Encode(c)
+}
+
+func cacheKey(profile string) string {
+	return fmt.Sprintf("aws.%s.cache", profile)
+}
+
+func cacheFile(profile string) string {
+	return path.Join(cacheDir, cacheKey(profile))
 }
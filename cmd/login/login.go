@@ -1,12 +1,23 @@
 package login
 
 import (
+	"context"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion/samlassertioniface"
@@ -14,14 +25,27 @@ import (
 
 type Event interface {
 	ChooseDeviceIndex(devices []samlassertion.GenerateResponseFactorDevice) (int, error)
-	InputMFAToken() (string, error)
+	InputMFAToken(device samlassertion.GenerateResponseFactorDevice) (string, error)
+	ChooseRoleIndex(roles []saml.Role) (int, error)
+}
+
+// Waiter is implemented by the Event showing the progress
+// while the push notification of the device waits for the approval until the timeout
+type Waiter interface {
+	WaitForApproval(device samlassertion.GenerateResponseFactorDevice, timeout time.Duration) (done func())
 }
 
+// DefaultSessionName is the role session name of chained roles
+// when the SAML assumed role user is unknown
+const DefaultSessionName = "onelogin-aws-connector"
+
 // Login represents login
 type Login struct {
 	SAMLAssertion samlassertioniface.SAMLAssertionAPI
 	STS           stsiface.STSAPI
-	Params        *Parameters
+	// ChainSTS creates STS client with the credentials of the previous role
+	ChainSTS func(creds *sts.Credentials) (stsiface.STSAPI, error)
+	Params   *Parameters
 }
 
 // Parameters represents login parameters
@@ -32,91 +56,337 @@ type Parameters struct {
 	Subdomain       string
 	PrincipalArn    string
 	RoleArn         string
+	RoleMatch       string
 	DurationSeconds int64
+	Chain           []ChainedRole
+	MFADevice       string
+	// ApprovalTimeout is the deadline of the push notification approval if it is not zero
+	ApprovalTimeout time.Duration
+	// APIVersion is the version of OneLogin SAML assertion API, which is 1 if it is zero
+	APIVersion int
+	// STSEndpoint is the endpoint of AWS STS if it is not empty
+	STSEndpoint string
+}
+
+// ChainedRole represents a role assumed with the credentials of the previous role
+type ChainedRole struct {
+	RoleArn         string
+	ExternalID      string
+	SessionName     string
+	DurationSeconds int64
+}
+
+// approvalTimeout returns the deadline of the push notification approval which the poller uses
+func (p *Parameters) approvalTimeout() time.Duration {
+	if p.ApprovalTimeout > 0 {
+		return p.ApprovalTimeout
+	}
+	return samlassertion.DefaultApprovalTimeout
 }
 
 // New creates a Login instance
 func New(config *onelogin.Config, params *Parameters) *Login {
+	poller := samlassertion.NewPoller()
+	poller.Timeout = params.approvalTimeout()
+	var assertion samlassertioniface.SAMLAssertionAPI
+	if params.APIVersion == 2 {
+		v2 := samlassertion.NewSAMLAssertionV2(config)
+		v2.Poller = poller
+		assertion = v2
+	} else {
+		v1 := samlassertion.NewSAMLAssertion(config)
+		v1.Poller = poller
+		assertion = v1
+	}
 	return &Login{
-		SAMLAssertion: samlassertion.NewSAMLAssertion(config),
+		SAMLAssertion: assertion,
 		Params:        params,
 	}
 }
 
+// Login returns AWS credentials of the role through OneLogin SAML
 func (l *Login) Login(logic Event) (*sts.Credentials, error) {
-	assertion, err := l.generateAssertion()
+	return l.LoginWithContext(context.Background(), logic)
+}
+
+// LoginWithContext is Login canceled with the context
+func (l *Login) LoginWithContext(ctx context.Context, logic Event) (*sts.Credentials, error) {
+	SAML, err := l.AssertionWithContext(ctx, logic)
 	if err != nil {
 		return nil, err
 	}
+	return l.AssumeRoleWithContext(ctx, SAML, l.Params, logic)
+}
+
+// Assertion returns the base64 encoded SAML Response, verifying MFA if required
+func (l *Login) Assertion(logic Event) (string, error) {
+	return l.AssertionWithContext(context.Background(), logic)
+}
+
+// AssertionWithContext is Assertion canceled with the context
+func (l *Login) AssertionWithContext(ctx context.Context, logic Event) (string, error) {
+	assertion, err := l.generateAssertion(ctx)
+	if err != nil {
+		return "", classify(failure.Auth, err)
+	}
 	SAML := assertion.SAML
 	if SAML == "" {
 		factor := assertion.Factors[0]
 		selected := 0
 		length := len(factor.Devices)
 		if length > 1 {
-			selected, err = logic.ChooseDeviceIndex(factor.Devices)
-			if err != nil {
-				return nil, err
+			var ok bool
+			selected, ok = PreferredDeviceIndex(factor.Devices, l.Params.MFADevice)
+			if !ok {
+				selected, err = logic.ChooseDeviceIndex(factor.Devices)
+				if err != nil {
+					return "", err
+				}
 			}
 		}
 		device := factor.Devices[selected]
+		logging.Debug("verify MFA", logging.F("DeviceID", device.DeviceID), logging.F("DeviceType", device.DeviceType))
 		deviceID := device.DeviceID
 		var token string
 		if device.RequireOTPToken {
-			token, err = logic.InputMFAToken()
+			token, err = logic.InputMFAToken(device)
 			if err != nil {
-				return nil, err
+				return "", err
 			}
 		}
-		verified, err := l.generateAssertionWithMFA(deviceID, factor.StateToken, token)
+		done := func() {}
+		if waiter, ok := logic.(Waiter); ok && !device.RequireOTPToken {
+			done = waiter.WaitForApproval(device, l.Params.approvalTimeout())
+		}
+		verified, err := l.generateAssertionWithMFA(ctx, deviceID, factor.StateToken, factor.CallbackURL, token)
+		done()
 		if err != nil {
-			return nil, err
+			return "", classify(failure.Auth, err)
 		}
 		SAML = verified.SAML
 	}
-	return l.assumeRole(SAML)
+	return SAML, nil
+}
+
+// classify wraps the error with the code for the exit status of the command.
+// The errors caused by the context are left for the caller, and the push notification errors have their own codes.
+func classify(code failure.Code, err error) error {
+	switch errors.Cause(err) {
+	case context.Canceled, context.DeadlineExceeded:
+		return err
+	case samlassertion.ErrDenied:
+		code = failure.MFADenied
+	case samlassertion.ErrTimedOut:
+		code = failure.MFATimeout
+	}
+	return failure.Wrap(code, err)
+}
+
+// PreferredDeviceIndex returns the MFA device matching the DeviceType or the DeviceID of the preference.
+// The synthesized push notification device shares the DeviceID of OneLogin Protect,
+// so the DeviceID selects the push notification, and the OTP of OneLogin Protect is selected by the DeviceType.
+func PreferredDeviceIndex(devices []samlassertion.GenerateResponseFactorDevice, preference string) (int, bool) {
+	if preference == "" {
+		return 0, false
+	}
+	for i, device := range devices {
+		if strings.EqualFold(device.DeviceType, preference) {
+			return i, true
+		}
+	}
+	id, err := strconv.Atoi(preference)
+	if err != nil {
+		return 0, false
+	}
+	selected, ok := 0, false
+	for i, device := range devices {
+		if device.DeviceID != id {
+			continue
+		}
+		if device.DeviceType == samlassertion.NotifyDeviceType {
+			return i, true
+		}
+		if !ok {
+			selected, ok = i, true
+		}
+	}
+	return selected, ok
+}
+
+// AssumeRole assumes the role of the params with the SAML Response.
+// The SAML Response can be shared by the roles of the same OneLogin app.
+func (l *Login) AssumeRole(SAML string, params *Parameters, logic Event) (*sts.Credentials, error) {
+	return l.AssumeRoleWithContext(context.Background(), SAML, params, logic)
+}
+
+// AssumeRoleWithContext is AssumeRole canceled with the context
+func (l *Login) AssumeRoleWithContext(ctx context.Context, SAML string, params *Parameters, logic Event) (*sts.Credentials, error) {
+	role, err := selectRole(SAML, params, logic)
+	if err != nil {
+		return nil, classify(failure.Config, err)
+	}
+	logging.Debug("assume role with SAML", logging.F("RoleArn", role.RoleArn), logging.F("PrincipalArn", role.PrincipalArn))
+	output, err := l.assumeRole(ctx, SAML, role, params.DurationSeconds)
+	if err != nil {
+		return nil, classify(failure.STS, err)
+	}
+	if len(params.Chain) == 0 {
+		return output.Credentials, nil
+	}
+	sessionName := DefaultSessionName
+	if output.AssumedRoleUser != nil && output.AssumedRoleUser.Arn != nil {
+		arn := *output.AssumedRoleUser.Arn
+		sessionName = arn[strings.LastIndex(arn, "/")+1:]
+	}
+	return l.chain(ctx, output.Credentials, sessionName, params.Chain)
+}
+
+// selectRole returns the configured role, or discovers it from the SAML Response
+func selectRole(SAML string, params *Parameters, logic Event) (saml.Role, error) {
+	if params.RoleMatch == "" && params.RoleArn != "" && params.PrincipalArn != "" {
+		return saml.Role{
+			RoleArn:      params.RoleArn,
+			PrincipalArn: params.PrincipalArn,
+		}, nil
+	}
+	roles, err := saml.ParseRoles(SAML)
+	if err != nil {
+		return saml.Role{}, err
+	}
+	match := params.RoleMatch
+	if match == "" {
+		match = params.RoleArn
+	}
+	if match != "" {
+		candidates := []saml.Role{}
+		for _, role := range roles {
+			if role.Match(match) {
+				candidates = append(candidates, role)
+			}
+		}
+		if len(candidates) == 0 {
+			return saml.Role{}, errors.Errorf("%s role is not exists in SAML Response", match)
+		}
+		roles = candidates
+	}
+	selected := 0
+	if len(roles) > 1 {
+		selected, err = logic.ChooseRoleIndex(roles)
+		if err != nil {
+			return saml.Role{}, err
+		}
+		if selected < 0 || selected >= len(roles) {
+			return saml.Role{}, errors.Errorf("%d is out of range of roles", selected)
+		}
+	}
+	return roles[selected], nil
 }
 
 // Execute represents login flow
-func (l *Login) generateAssertion() (*samlassertion.GenerateResponse, error) {
+func (l *Login) generateAssertion(ctx context.Context) (*samlassertion.GenerateResponse, error) {
 	input := &samlassertion.GenerateRequest{
 		UsernameOrEmail: l.Params.UsernameOrEmail,
 		Password:        l.Params.Password,
 		AppID:           l.Params.AppID,
 		Subdomain:       l.Params.Subdomain,
 	}
-	return l.SAMLAssertion.Generate(input)
+	return l.SAMLAssertion.GenerateWithContext(ctx, input)
 }
 
-func (l *Login) generateAssertionWithMFA(deviceId int, stateToken string, otpToken string) (*samlassertion.VerifyFactorResponse, error) {
+func (l *Login) generateAssertionWithMFA(ctx context.Context, deviceId int, stateToken string, callbackURL string, otpToken string) (*samlassertion.VerifyFactorResponse, error) {
 	input := &samlassertion.VerifyFactorRequest{
 		AppID:       l.Params.AppID,
 		DeviceID:    strconv.Itoa(deviceId),
 		StateToken:  stateToken,
 		OtpToken:    otpToken,
 		DoNotNotify: otpToken != "",
+		CallbackURL: callbackURL,
 	}
-	return l.SAMLAssertion.VerifyFactor(input)
+	return l.SAMLAssertion.VerifyFactorWithContext(ctx, input)
 }
 
 // Execute represents login flow
-func (l *Login) assumeRole(SAML string) (*sts.Credentials, error) {
+func (l *Login) assumeRole(ctx context.Context, SAML string, role saml.Role, duration int64) (*sts.AssumeRoleWithSAMLOutput, error) {
 	if l.STS == nil {
-		s, err := session.NewSession()
+		client, err := newSTS(l.Params.STSEndpoint)
 		if err != nil {
 			return nil, err
 		}
-		l.STS = sts.New(s)
+		l.STS = client
 	}
 	assumeRoleInput := &sts.AssumeRoleWithSAMLInput{
-		PrincipalArn:    &l.Params.PrincipalArn,
-		RoleArn:         &l.Params.RoleArn,
+		PrincipalArn:    &role.PrincipalArn,
+		RoleArn:         &role.RoleArn,
 		SAMLAssertion:   &SAML,
-		DurationSeconds: &l.Params.DurationSeconds,
+		DurationSeconds: &duration,
 	}
-	assumeRoleOutput, err := l.STS.AssumeRoleWithSAML(assumeRoleInput)
+	return l.STS.AssumeRoleWithSAMLWithContext(ctx, assumeRoleInput)
+}
+
+// chain assumes the chained roles in order with the credentials of the previous role
+func (l *Login) chain(ctx context.Context, creds *sts.Credentials, sessionName string, chain []ChainedRole) (*sts.Credentials, error) {
+	if l.ChainSTS == nil {
+		l.ChainSTS = func(creds *sts.Credentials) (stsiface.STSAPI, error) {
+			return NewCredentialsSTS(creds, l.Params.STSEndpoint)
+		}
+	}
+	for _, hop := range chain {
+		client, err := l.ChainSTS(creds)
+		if err != nil {
+			return nil, classify(failure.STS, err)
+		}
+		input := &sts.AssumeRoleInput{
+			RoleArn:         aws.String(hop.RoleArn),
+			RoleSessionName: aws.String(sessionName),
+		}
+		if hop.SessionName != "" {
+			input.RoleSessionName = aws.String(hop.SessionName)
+		}
+		if hop.ExternalID != "" {
+			input.ExternalId = aws.String(hop.ExternalID)
+		}
+		if hop.DurationSeconds != 0 {
+			input.DurationSeconds = aws.Int64(hop.DurationSeconds)
+		}
+		logging.Debug("assume chained role", logging.F("RoleArn", hop.RoleArn), logging.F("RoleSessionName", *input.RoleSessionName))
+		output, err := client.AssumeRoleWithContext(ctx, input)
+		if err != nil {
+			return nil, classify(failure.STS, errors.Wrapf(err, "failed to assume %s", hop.RoleArn))
+		}
+		creds = output.Credentials
+	}
+	return creds, nil
+}
+
+// NewCredentialsSTS creates STS client signed with the assumed credentials, such as for the chained roles.
+// The endpoint is the default endpoint if it is empty.
+func NewCredentialsSTS(creds *sts.Credentials, endpoint string) (stsiface.STSAPI, error) {
+	return newSTS(endpoint, &aws.Config{
+		Credentials: credentials.NewStaticCredentials(*creds.AccessKeyId, *creds.SecretAccessKey, *creds.SessionToken),
+	})
+}
+
+// newSTS creates STS client calling the endpoint if it is not empty
+func newSTS(endpoint string, configs ...*aws.Config) (stsiface.STSAPI, error) {
+	s, err := session.NewSession(configs...)
 	if err != nil {
 		return nil, err
 	}
-	return assumeRoleOutput.Credentials, nil
+	// the requests are traced by --debug with the credentials redacted,
+	// and the client of the session is copied not to change http.DefaultClient
+	client := http.Client{}
+	if s.Config.HTTPClient != nil {
+		client = *s.Config.HTTPClient
+	}
+	client.Transport = logging.NewTransport(client.Transport)
+	config := aws.NewConfig().WithHTTPClient(&client)
+	if endpoint == "" {
+		return sts.New(s, config), nil
+	}
+	config = config.WithEndpoint(endpoint)
+	if aws.StringValue(s.Config.Region) == "" {
+		// STS is a global service, and the region is only used to sign the requests
+		config = config.WithRegion("us-east-1")
+	}
+	return sts.New(s, config), nil
 }
@@ -1,15 +1,26 @@
 package login
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/mockserver"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
 )
 
@@ -36,11 +47,34 @@ func (s *SAMLAssertionMock) VerifyFactor(request *samlassertion.VerifyFactorRequ
 	return s.VerifyFactorResponse, s.VerifyFactorError
 }
 
+func (s *SAMLAssertionMock) GenerateWithContext(ctx context.Context, request *samlassertion.GenerateRequest) (*samlassertion.GenerateResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Generate(request)
+}
+
+func (s *SAMLAssertionMock) VerifyFactorWithContext(ctx context.Context, request *samlassertion.VerifyFactorRequest) (*samlassertion.VerifyFactorResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.VerifyFactor(request)
+}
+
 type STSMock struct {
 	stsiface.STSAPI
 	AssumeRoleWithSAMLOutput *sts.AssumeRoleWithSAMLOutput
 	Error                    error
 	InputVerifier            func(*sts.AssumeRoleWithSAMLInput) error
+	AssumeRoleOutput         *sts.AssumeRoleOutput
+	AssumeRoleInputVerifier  func(*sts.AssumeRoleInput) error
+}
+
+func (s *STSMock) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	if err := s.AssumeRoleInputVerifier(input); err != nil {
+		return nil, err
+	}
+	return s.AssumeRoleOutput, s.Error
 }
 
 func (s *STSMock) AssumeRoleWithSAML(input *sts.AssumeRoleWithSAMLInput) (*sts.AssumeRoleWithSAMLOutput, error) {
@@ -50,19 +84,47 @@ func (s *STSMock) AssumeRoleWithSAML(input *sts.AssumeRoleWithSAMLInput) (*sts.A
 	return s.AssumeRoleWithSAMLOutput, s.Error
 }
 
+func (s *STSMock) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, options ...request.Option) (*sts.AssumeRoleOutput, error) {
+	return s.AssumeRole(input)
+}
+
+func (s *STSMock) AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, options ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error) {
+	return s.AssumeRoleWithSAML(input)
+}
+
 type EventMock struct {
-	DeviceIndex int
-	ChooseError error
-	MFAToken    string
-	InputError  error
+	DeviceIndex     int
+	ChooseError     error
+	MFAToken        string
+	InputError      error
+	RoleIndex       int
+	ChooseRoleError error
 }
 
 func (m *EventMock) ChooseDeviceIndex(devices []samlassertion.GenerateResponseFactorDevice) (int, error) {
 	return m.DeviceIndex, m.ChooseError
 }
-func (m *EventMock) InputMFAToken() (string, error) {
+func (m *EventMock) InputMFAToken(device samlassertion.GenerateResponseFactorDevice) (string, error) {
 	return m.MFAToken, m.InputError
 }
+func (m *EventMock) ChooseRoleIndex(roles []saml.Role) (int, error) {
+	return m.RoleIndex, m.ChooseRoleError
+}
+
+type WaiterMock struct {
+	EventMock
+	Waiting  []string
+	Timeouts []time.Duration
+	Done     int
+}
+
+func (m *WaiterMock) WaitForApproval(device samlassertion.GenerateResponseFactorDevice, timeout time.Duration) func() {
+	m.Waiting = append(m.Waiting, device.DeviceType)
+	m.Timeouts = append(m.Timeouts, timeout)
+	return func() {
+		m.Done++
+	}
+}
 
 func createAssertion(t *testing.T) *SAMLAssertionMock {
 	return &SAMLAssertionMock{
@@ -169,7 +231,12 @@ func createAssertionForNotify(t *testing.T) *SAMLAssertionMock {
 			DeviceType: "Notify OneLogin Protect",
 			RequireOTPToken: false,
 		})
+	callback := "https://api.us.onelogin.com/api/1/saml_assertion/verify_factor"
+	assertion.GenerateResponse.Factors[0].CallbackURL = callback
 	assertion.VerifyFactorInputVerifier = func(request *samlassertion.VerifyFactorRequest) error {
+		if request.CallbackURL != callback {
+			t.Errorf("%s is not equal %s", request.CallbackURL, callback)
+		}
 		if request.AppID != "app-id" {
 			t.Errorf("%s is not equal %s", request.AppID, "app-id")
 		}
@@ -308,6 +375,42 @@ func TestLogin_LoginWithMultipleMFA(t *testing.T) {
 	}
 }
 
+func TestLogin_LoginWithPreferredMFA(t *testing.T) {
+	for _, preference := range []string{"device type 2", "DEVICE TYPE 2", "987654"} {
+		params := createDefaultParams()
+		params.MFADevice = preference
+		l := &Login{
+			SAMLAssertion: createAssertionForMultipleMFA(t),
+			STS:           createSTS(t),
+			Params:        params,
+		}
+		_, err := l.Login(&EventMock{
+			ChooseError: errors.New("Don't call choose function"),
+			MFAToken:    "098765",
+		})
+		if err != nil {
+			t.Errorf("%s: %v", preference, err)
+		}
+	}
+}
+
+func TestLogin_LoginWithUnmatchedPreferredMFA(t *testing.T) {
+	params := createDefaultParams()
+	params.MFADevice = "unknown device"
+	l := &Login{
+		SAMLAssertion: createAssertionForMultipleMFA(t),
+		STS:           createSTS(t),
+		Params:        params,
+	}
+	_, err := l.Login(&EventMock{
+		DeviceIndex: 1,
+		MFAToken:    "098765",
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
 func TestLogin_LoginWithNotify(t *testing.T) {
 	l := &Login{
 		SAMLAssertion: createAssertionForNotify(t),
@@ -322,6 +425,61 @@ func TestLogin_LoginWithNotify(t *testing.T) {
 	}
 }
 
+func TestLogin_LoginWithNotifyWaiter(t *testing.T) {
+	l := &Login{
+		SAMLAssertion: createAssertionForNotify(t),
+		STS:           createSTS(t),
+		Params:        createDefaultParams(),
+	}
+	event := &WaiterMock{EventMock: EventMock{DeviceIndex: 1}}
+	_, err := l.Login(event)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if len(event.Waiting) != 1 || event.Done != 1 {
+		t.Errorf("%v and %d are not equal one waiting", event.Waiting, event.Done)
+	}
+	// the countdown is of the timeout the poller uses even if it is not configured
+	if len(event.Timeouts) != 1 || event.Timeouts[0] != samlassertion.DefaultApprovalTimeout {
+		t.Errorf("%v is not equal %v", event.Timeouts, samlassertion.DefaultApprovalTimeout)
+	}
+}
+
+func TestLogin_LoginWithOTPWaiter(t *testing.T) {
+	l := &Login{
+		SAMLAssertion: createAssertionForSingleMFA(t),
+		STS:           createSTS(t),
+		Params:        createDefaultParams(),
+	}
+	event := &WaiterMock{EventMock: EventMock{MFAToken: "765432"}}
+	_, err := l.Login(event)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if len(event.Waiting) != 0 {
+		t.Errorf("%v is not empty", event.Waiting)
+	}
+}
+
+func TestLogin_LoginWithCanceledContext(t *testing.T) {
+	l := &Login{
+		SAMLAssertion: createAssertionForNotify(t),
+		STS:           createSTS(t),
+		Params:        createDefaultParams(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	event := &WaiterMock{EventMock: EventMock{DeviceIndex: 1}}
+	_, err := l.LoginWithContext(ctx, event)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	cancel()
+	_, err = l.LoginWithContext(ctx, event)
+	if err != context.Canceled {
+		t.Errorf("%v is not equal %v", err, context.Canceled)
+	}
+}
+
 func TestLogin_LoginChooseErrorWithMFA(t *testing.T) {
 	l := &Login{
 		SAMLAssertion: createAssertionForMultipleMFA(t),
@@ -351,6 +509,364 @@ func TestLogin_LoginMFAErrorWithMFA(t *testing.T) {
 	}
 }
 
+const samlResponseWithRoles = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/Admin,arn:aws:iam::123456789012:saml-provider/OneLogin</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/ReadOnly,arn:aws:iam::123456789012:saml-provider/OneLogin</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func createAssertionWithRoles(t *testing.T) *SAMLAssertionMock {
+	assertion := createAssertion(t)
+	assertion.GenerateResponse.SAML = base64.StdEncoding.EncodeToString([]byte(samlResponseWithRoles))
+	return assertion
+}
+
+func createSTSForRole(t *testing.T, roleArn string) *STSMock {
+	s := createSTS(t)
+	s.InputVerifier = func(request *sts.AssumeRoleWithSAMLInput) error {
+		if *request.PrincipalArn != "arn:aws:iam::123456789012:saml-provider/OneLogin" {
+			t.Errorf("%s is not equal %s", *request.PrincipalArn, "arn:aws:iam::123456789012:saml-provider/OneLogin")
+		}
+		if *request.RoleArn != roleArn {
+			t.Errorf("%s is not equal %s", *request.RoleArn, roleArn)
+		}
+		return nil
+	}
+	return s
+}
+
+func TestLogin_LoginWithRoleDiscovery(t *testing.T) {
+	params := createDefaultParams()
+	params.RoleArn = ""
+	params.PrincipalArn = ""
+	l := &Login{
+		SAMLAssertion: createAssertionWithRoles(t),
+		STS:           createSTSForRole(t, "arn:aws:iam::123456789012:role/ReadOnly"),
+		Params:        params,
+	}
+	_, err := l.Login(&EventMock{
+		ChooseError: errors.New("Don't call choose function"),
+		InputError:  errors.New("Don't call input function"),
+		RoleIndex:   1,
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestLogin_LoginWithRoleMatch(t *testing.T) {
+	params := createDefaultParams()
+	params.RoleMatch = "Admin"
+	l := &Login{
+		SAMLAssertion: createAssertionWithRoles(t),
+		STS:           createSTSForRole(t, "arn:aws:iam::123456789012:role/Admin"),
+		Params:        params,
+	}
+	_, err := l.Login(&EventMock{
+		ChooseError:     errors.New("Don't call choose function"),
+		InputError:      errors.New("Don't call input function"),
+		ChooseRoleError: errors.New("Don't call choose role function"),
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestLogin_LoginWithRoleArnOnly(t *testing.T) {
+	params := createDefaultParams()
+	params.RoleArn = "arn:aws:iam::123456789012:role/ReadOnly"
+	params.PrincipalArn = ""
+	l := &Login{
+		SAMLAssertion: createAssertionWithRoles(t),
+		STS:           createSTSForRole(t, "arn:aws:iam::123456789012:role/ReadOnly"),
+		Params:        params,
+	}
+	_, err := l.Login(&EventMock{
+		ChooseError:     errors.New("Don't call choose function"),
+		InputError:      errors.New("Don't call input function"),
+		ChooseRoleError: errors.New("Don't call choose role function"),
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestLogin_LoginWithRoleMismatch(t *testing.T) {
+	params := createDefaultParams()
+	params.RoleMatch = "PowerUser"
+	l := &Login{
+		SAMLAssertion: createAssertionWithRoles(t),
+		STS:           createSTS(t),
+		Params:        params,
+	}
+	_, err := l.Login(&EventMock{})
+	if err == nil || err.Error() != "PowerUser role is not exists in SAML Response" {
+		t.Errorf("%v is not equal 'PowerUser role is not exists in SAML Response'", err)
+	}
+}
+
 func StringRef(v string) *string {
 	return &v
 }
+
+func TestLogin_AssumeRoleWithSharedAssertion(t *testing.T) {
+	params := createDefaultParams()
+	params.RoleArn = ""
+	params.PrincipalArn = ""
+	s := createSTS(t)
+	assumed := []string{}
+	s.InputVerifier = func(request *sts.AssumeRoleWithSAMLInput) error {
+		assumed = append(assumed, *request.RoleArn)
+		return nil
+	}
+	l := &Login{
+		SAMLAssertion: createAssertionWithRoles(t),
+		STS:           s,
+		Params:        params,
+	}
+	event := &EventMock{
+		ChooseError:     errors.New("Don't call choose function"),
+		InputError:      errors.New("Don't call input function"),
+		ChooseRoleError: errors.New("Don't call choose role function"),
+	}
+	SAML, err := l.Assertion(event)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	for _, roleName := range []string{"Admin", "ReadOnly"} {
+		p := *params
+		p.RoleArn = roleName
+		if _, err := l.AssumeRole(SAML, &p, event); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	expected := []string{
+		"arn:aws:iam::123456789012:role/Admin",
+		"arn:aws:iam::123456789012:role/ReadOnly",
+	}
+	if fmt.Sprint(assumed) != fmt.Sprint(expected) {
+		t.Errorf("%v is not equal %v", assumed, expected)
+	}
+}
+
+func TestLogin_LoginWithChain(t *testing.T) {
+	params := createDefaultParams()
+	params.Chain = []ChainedRole{
+		{
+			RoleArn: "hub-role-arn",
+		},
+		{
+			RoleArn:         "workload-role-arn",
+			ExternalID:      "external-id",
+			SessionName:     "session-name",
+			DurationSeconds: 900,
+		},
+	}
+	s := createSTS(t)
+	s.AssumeRoleWithSAMLOutput.AssumedRoleUser = &sts.AssumedRoleUser{
+		Arn: StringRef("arn:aws:sts::123456789012:assumed-role/role/username@example.com"),
+	}
+	hops := []string{}
+	l := &Login{
+		SAMLAssertion: createAssertion(t),
+		STS:           s,
+		ChainSTS: func(creds *sts.Credentials) (stsiface.STSAPI, error) {
+			hop := &STSMock{
+				AssumeRoleOutput: &sts.AssumeRoleOutput{
+					Credentials: &sts.Credentials{
+						AccessKeyId:     StringRef(fmt.Sprintf("access-key-id-%d", len(hops)+1)),
+						SecretAccessKey: StringRef("secret-access-key"),
+						SessionToken:    StringRef("session-token"),
+					},
+				},
+				AssumeRoleInputVerifier: func(input *sts.AssumeRoleInput) error {
+					hops = append(hops, fmt.Sprintf("%s %s %s", *creds.AccessKeyId, *input.RoleArn, *input.RoleSessionName))
+					return nil
+				},
+			}
+			return hop, nil
+		},
+		Params: params,
+	}
+	creds, err := l.Login(&EventMock{
+		ChooseError: errors.New("Don't call choose function"),
+		InputError:  errors.New("Don't call input function"),
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	expected := "[access-key-id hub-role-arn username@example.com access-key-id-1 workload-role-arn session-name]"
+	if fmt.Sprint(hops) != expected {
+		t.Errorf("%v is not equal %v", hops, expected)
+	}
+	if *creds.AccessKeyId != "access-key-id-2" {
+		t.Errorf("%s is not equal %s", *creds.AccessKeyId, "access-key-id-2")
+	}
+}
+
+func TestLogin_LoginWithChainError(t *testing.T) {
+	params := createDefaultParams()
+	params.Chain = []ChainedRole{{RoleArn: "hub-role-arn"}}
+	l := &Login{
+		SAMLAssertion: createAssertion(t),
+		STS:           createSTS(t),
+		ChainSTS: func(creds *sts.Credentials) (stsiface.STSAPI, error) {
+			return &STSMock{
+				Error: errors.New("access denied"),
+				AssumeRoleInputVerifier: func(input *sts.AssumeRoleInput) error {
+					return nil
+				},
+			}, nil
+		},
+		Params: params,
+	}
+	_, err := l.Login(&EventMock{})
+	if err == nil || err.Error() != "failed to assume hub-role-arn: access denied" {
+		t.Errorf("%v is not equal 'failed to assume hub-role-arn: access denied'", err)
+	}
+}
+
+func TestNew_ApprovalTimeout(t *testing.T) {
+	config := onelogin.NewConfig("endpoint", "client-token", "client-secret")
+	l := New(config, &Parameters{})
+	if timeout := l.SAMLAssertion.(*samlassertion.SAMLAssertion).Poller.Timeout; timeout != samlassertion.DefaultApprovalTimeout {
+		t.Errorf("%v is not equal %v", timeout, samlassertion.DefaultApprovalTimeout)
+	}
+	l = New(config, &Parameters{ApprovalTimeout: 2 * time.Minute})
+	if timeout := l.SAMLAssertion.(*samlassertion.SAMLAssertion).Poller.Timeout; timeout != 2*time.Minute {
+		t.Errorf("%v is not equal %v", timeout, 2*time.Minute)
+	}
+}
+
+func TestNew_APIVersion(t *testing.T) {
+	config := onelogin.NewConfig("endpoint", "client-token", "client-secret")
+	if _, ok := New(config, &Parameters{}).SAMLAssertion.(*samlassertion.SAMLAssertion); !ok {
+		t.Error("It need to use API v1 by default.")
+	}
+	l := New(config, &Parameters{APIVersion: 2, ApprovalTimeout: time.Minute})
+	v2, ok := l.SAMLAssertion.(*samlassertion.SAMLAssertionV2)
+	if !ok {
+		t.Fatal("It need to use API v2.")
+	}
+	if v2.Poller.Timeout != time.Minute {
+		t.Errorf("%v is not equal %v", v2.Poller.Timeout, time.Minute)
+	}
+}
+
+func TestLogin_LoginWithMockServer(t *testing.T) {
+	server, err := mockserver.New(mockserver.OTP)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	config := onelogin.NewConfig(ts.URL, mockserver.DefaultClientToken, mockserver.DefaultClientSecret)
+	l := New(config, &Parameters{
+		UsernameOrEmail: mockserver.DefaultUsernameOrEmail,
+		Password:        mockserver.DefaultPassword,
+		AppID:           "app-id",
+		Subdomain:       "mock",
+		RoleMatch:       "ReadOnly",
+		DurationSeconds: 3600,
+		Chain:           []ChainedRole{{RoleArn: "arn:aws:iam::210987654321:role/Workload"}},
+		STSEndpoint:     ts.URL + "/sts",
+	})
+	creds, err := l.Login(&EventMock{
+		MFAToken:        mockserver.DefaultOTPToken,
+		ChooseError:     errors.New("Don't call choose function"),
+		ChooseRoleError: errors.New("Don't call choose role function"),
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !strings.HasPrefix(*creds.AccessKeyId, "ASIA") {
+		t.Errorf("%s is not temporary access key", *creds.AccessKeyId)
+	}
+}
+
+func TestLogin_LoginErrorCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario mockserver.Scenario
+		role     string
+		password string
+		sts      stsiface.STSAPI
+		want     failure.Code
+	}{
+		{name: "denied", scenario: mockserver.Denied, want: failure.MFADenied},
+		{name: "invalid password", scenario: mockserver.NoMFA, password: "invalid", want: failure.Auth},
+		// the access tokens expiring at once do not fail the login
+		{name: "expired token", scenario: mockserver.ExpiredToken},
+		{name: "role mismatch", scenario: mockserver.NoMFA, role: "Missing", want: failure.Config},
+		{name: "sts", scenario: mockserver.NoMFA, sts: &STSMock{
+			Error: awserr.New("AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML", nil),
+			InputVerifier: func(input *sts.AssumeRoleWithSAMLInput) error {
+				return nil
+			},
+		}, want: failure.STS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := mockserver.New(tt.scenario)
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+			config := onelogin.NewConfig(ts.URL, mockserver.DefaultClientToken, mockserver.DefaultClientSecret)
+			password := mockserver.DefaultPassword
+			if tt.password != "" {
+				password = tt.password
+			}
+			l := New(config, &Parameters{
+				UsernameOrEmail: mockserver.DefaultUsernameOrEmail,
+				Password:        password,
+				AppID:           "app-id",
+				Subdomain:       "mock",
+				RoleMatch:       tt.role,
+				DurationSeconds: 3600,
+				STSEndpoint:     ts.URL + "/sts",
+			})
+			l.SAMLAssertion.(*samlassertion.SAMLAssertion).Poller.Interval = time.Millisecond
+			if tt.sts != nil {
+				l.STS = tt.sts
+			}
+			_, err = l.Login(&EventMock{RoleIndex: 0})
+			if code := failure.CodeOf(err); code != tt.want {
+				t.Errorf("%s is not equal %s: %v", code, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPreferredDeviceIndex(t *testing.T) {
+	devices := []samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: "OneLogin Protect", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+	}
+	tests := []struct {
+		preference string
+		want       int
+		ok         bool
+	}{
+		{preference: "1", want: 0, ok: true},
+		{preference: "2", want: 2, ok: true},
+		{preference: "onelogin protect", want: 1, ok: true},
+		{preference: samlassertion.NotifyDeviceType, want: 2, ok: true},
+		{preference: "3", ok: false},
+		{preference: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := PreferredDeviceIndex(devices, tt.preference)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: %d, %v is not equal %d, %v", tt.preference, got, ok, tt.want, tt.ok)
+		}
+	}
+}
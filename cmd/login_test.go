@@ -1,6 +1,23 @@
 package cmd
 
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/password"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/tui"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+)
 
 func TestLoginCmdFetchConfigConfigVars(t *testing.T) {
 	_, app, err := fetchConfig("fixtures/fullfilled.toml", "other")
@@ -18,6 +35,57 @@ func TestLoginCmdFetchConfigConfigVars(t *testing.T) {
 	}
 }
 
+func TestLoginCmdFetchConfigNamedService(t *testing.T) {
+	service, app, err := fetchConfig("fixtures/multiservice.toml", "sandbox")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if service.Endpoint != "sandbox-api-server" {
+		t.Errorf("%s is not equal %s", service.Endpoint, "sandbox-api-server")
+	}
+	if service.ClientToken != "sandbox-client-token" {
+		t.Errorf("%s is not equal %s", service.ClientToken, "sandbox-client-token")
+	}
+	if app.RoleArn != "sandbox-role-arn" {
+		t.Errorf("%s is not equal %s", app.RoleArn, "sandbox-role-arn")
+	}
+	service, _, err = fetchConfig("fixtures/multiservice.toml", "default")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if service.Endpoint != "api-server" {
+		t.Errorf("%s is not equal %s", service.Endpoint, "api-server")
+	}
+	_, _, err = fetchConfig("fixtures/multiservice.toml", "missing")
+	if err == nil || err.Error() != "missing service is not exists" {
+		t.Errorf("%v is not equal %s", err, "missing service is not exists")
+	}
+}
+
+func TestLoginCmdFetchConfigPlainHTTP(t *testing.T) {
+	// the hand-edited endpoint is checked like init --endpoint
+	_, _, err := fetchConfig("fixtures/plainhttp.toml", "default")
+	if code := failure.CodeOf(err); code != failure.Config {
+		t.Errorf("%s is not equal %s: %v", code, failure.Config, err)
+	}
+	if _, _, err := fetchConfig("fixtures/plainhttp.toml", "local"); err != nil {
+		t.Errorf("%#v", err)
+	}
+}
+
+func TestLoginCmdBatchProfilesOtherService(t *testing.T) {
+	names, err := batchProfiles("fixtures/multiservice.toml", "sandbox", true, nil)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if fmt.Sprint(names) != "[sandbox]" {
+		t.Errorf("%v is not equal %v", names, "[sandbox]")
+	}
+	if _, err := batchProfiles("fixtures/multiservice.toml", "default", false, []string{"default", "sandbox"}); err == nil {
+		t.Error("It need to return not sharing service error.")
+	}
+}
+
 func TestLoginCmdFetchConfigNoProfile(t *testing.T) {
 	var err error
 	_, _, err = fetchConfig("fixtures/fullfilled.toml", "none")
@@ -25,3 +93,217 @@ func TestLoginCmdFetchConfigNoProfile(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestLoginCmdBatchProfilesAll(t *testing.T) {
+	targets, err := batchProfiles("fixtures/multiaccount.toml", "staging", true, nil)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	expected := "[default production staging]"
+	if fmt.Sprint(targets) != expected {
+		t.Errorf("%v is not equal %s", targets, expected)
+	}
+}
+
+func TestLoginCmdBatchProfilesNames(t *testing.T) {
+	targets, err := batchProfiles("fixtures/multiaccount.toml", "default", false, []string{"production", " staging"})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	expected := "[production staging]"
+	if fmt.Sprint(targets) != expected {
+		t.Errorf("%v is not equal %s", targets, expected)
+	}
+}
+
+func TestLoginCmdBatchProfilesOtherAppID(t *testing.T) {
+	_, err := batchProfiles("fixtures/multiaccount.toml", "default", false, []string{"production", "other"})
+	if err == nil || err.Error() != "other profile does not share AppID app-id" {
+		t.Errorf("%v is not equal 'other profile does not share AppID app-id'", err)
+	}
+}
+
+func TestLoginCmdBatchProfilesNoProfile(t *testing.T) {
+	_, err := batchProfiles("fixtures/multiaccount.toml", "none", true, nil)
+	if err == nil || err.Error() != "none profile is not exists" {
+		t.Errorf("%v is not equal 'none profile is not exists'", err)
+	}
+}
+
+func TestLoginCmdLoginEventWithOTP(t *testing.T) {
+	otpSource = SourceMock("123456")
+	defer func() {
+		otpSource = nil
+	}()
+	event := NewLoginEvent(bufio.NewReader(strings.NewReader("")))
+	selected, err := event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 1 {
+		t.Errorf("%d is not equal %d", selected, 1)
+	}
+	token, err := event.InputMFAToken(samlassertion.GenerateResponseFactorDevice{})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if token != "123456" {
+		t.Errorf("%s is not equal %s", token, "123456")
+	}
+
+	// every device of the API v1 requires the token, so the device is not guessed
+	_, err = event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: "OneLogin Protect", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+	})
+	if err == nil {
+		t.Error("It need to return ambiguous device error.")
+	}
+	if _, err := event.ChooseDeviceIndex([]samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+	}); err == nil {
+		t.Error("It need to return no device error.")
+	}
+}
+
+func TestLoginCmdLoginEventWithTerminalUI(t *testing.T) {
+	var out bytes.Buffer
+	event := NewLoginEvent(bufio.NewReader(strings.NewReader("")))
+	event.ui = tui.NewWithReader(strings.NewReader("goog\r\x1b[B\r654321\r"), &out)
+	devices := []samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+		{DeviceID: 1, DeviceType: "Google Authenticator", RequireOTPToken: true},
+	}
+	selected, err := event.ChooseDeviceIndex(devices)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 1 {
+		t.Errorf("%d is not equal %d", selected, 1)
+	}
+	selected, err = event.ChooseRoleIndex([]saml.Role{
+		{RoleArn: "arn:aws:iam::123456789012:role/developer"},
+		{RoleArn: "arn:aws:iam::123456789012:role/production"},
+	})
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 1 {
+		t.Errorf("%d is not equal %d", selected, 1)
+	}
+	token, err := event.InputMFAToken(devices[1])
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if token != "654321" {
+		t.Errorf("%s is not equal %s", token, "654321")
+	}
+	event.WaitForApproval(devices[0], time.Minute)()
+	if !strings.Contains(out.String(), "Waiting for approval on "+samlassertion.NotifyDeviceType) {
+		t.Errorf("%q does not show the spinner", out.String())
+	}
+}
+
+func TestLoginCmdLoginEventInterrupted(t *testing.T) {
+	var out bytes.Buffer
+	event := NewLoginEvent(bufio.NewReader(strings.NewReader("")))
+	event.ui = tui.NewWithReader(strings.NewReader("\x03"), &out)
+	_, err := event.ChooseRoleIndex([]saml.Role{
+		{RoleArn: "arn:aws:iam::123456789012:role/developer"},
+		{RoleArn: "arn:aws:iam::123456789012:role/production"},
+	})
+	if code := failure.CodeOf(err); code != failure.Canceled {
+		t.Errorf("%s is not equal %s: %v", code, failure.Canceled, err)
+	}
+}
+
+func TestLoginCmdLoginParametersMFADevice(t *testing.T) {
+	service := config.ServiceConfig{MFADevice: "service device"}
+	app := config.AppConfig{MFADevice: "profile device"}
+	defer func() {
+		mfaDevice = ""
+	}()
+	tests := []struct {
+		flag    string
+		service config.ServiceConfig
+		app     config.AppConfig
+		want    string
+	}{
+		{flag: "flag device", service: service, app: app, want: "flag device"},
+		{service: service, app: app, want: "profile device"},
+		{service: service, want: "service device"},
+		{want: ""},
+	}
+	for _, tt := range tests {
+		mfaDevice = tt.flag
+		params := loginParameters(tt.service, tt.app)
+		if params.MFADevice != tt.want {
+			t.Errorf("%s is not equal %s", params.MFADevice, tt.want)
+		}
+	}
+}
+
+func TestLoginCmdServicePasswordSource(t *testing.T) {
+	secrets = StoreMock{"password": "default-password", "password.sandbox": "sandbox-password"}
+	defer func() {
+		secrets = nil
+		passwordSource = nil
+	}()
+	tests := []struct {
+		name    string
+		service config.ServiceConfig
+		flag    password.Source
+		want    password.Source
+	}{
+		{name: "default", want: password.Keyring("password")},
+		{name: "sandbox", want: password.Keyring("password.sandbox")},
+		{name: "sandbox", flag: password.Env("PASSWORD"), want: password.Env("PASSWORD")},
+		{name: "sandbox", service: config.ServiceConfig{PasswordSource: "env:SANDBOX_PASSWORD"}, want: password.Env("SANDBOX_PASSWORD")},
+		// the flag overrides the config like --mfa-device
+		{name: "sandbox", service: config.ServiceConfig{PasswordSource: "env:SANDBOX_PASSWORD"}, flag: password.Env("PASSWORD"), want: password.Env("PASSWORD")},
+		{name: "other"},
+	}
+	for _, tt := range tests {
+		passwordSource = tt.flag
+		source, err := servicePasswordSource(tt.name, tt.service)
+		if err != nil {
+			t.Errorf("%#v", err)
+		}
+		if source != tt.want {
+			t.Errorf("%#v is not equal %#v", source, tt.want)
+		}
+	}
+	if _, err := servicePasswordSource("default", config.ServiceConfig{PasswordSource: "unknown"}); err == nil {
+		t.Error("It need to return unsupported source error.")
+	}
+}
+
+func TestLoginCmdLoginContextTimeout(t *testing.T) {
+	loginTimeout = time.Millisecond
+	defer func() {
+		loginTimeout = 5 * time.Minute
+	}()
+	ctx, cancel := loginContext(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	err := loginError(ctx, errors.New("context deadline exceeded"))
+	if err == nil || err.Error() != "login is timed out after 1ms" {
+		t.Errorf("%v is not equal %s", err, "login is timed out after 1ms")
+	}
+	if loginError(ctx, nil) != nil {
+		t.Error("It need to return nil without error.")
+	}
+}
+
+func TestLoginCmdLoginContextCanceled(t *testing.T) {
+	ctx, cancel := loginContext(context.Background())
+	cancel()
+	err := loginError(ctx, errors.New("context canceled"))
+	if err == nil || err.Error() != "login is canceled" {
+		t.Errorf("%v is not equal %s", err, "login is canceled")
+	}
+}
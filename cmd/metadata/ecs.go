@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// ECS emulates ECS container credentials endpoint for AWS_CONTAINER_CREDENTIALS_FULL_URI
+type ECS struct {
+	Provider Provider
+	Profiles []string
+	// AuthorizationToken is the value of AWS_CONTAINER_AUTHORIZATION_TOKEN
+	AuthorizationToken string
+}
+
+// ECSCredentials is the document of the container credentials endpoint
+type ECSCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// ECSError is the error document of the container credentials endpoint
+type ECSError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewECS creates an ECS serving the profiles on "/<profile>"
+func NewECS(provider Provider, profiles []string, token string) *ECS {
+	return &ECS{
+		Provider:           provider,
+		Profiles:           profiles,
+		AuthorizationToken: token,
+	}
+}
+
+func (s *ECS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, &ECSError{Code: "MethodNotAllowed", Message: "method not allowed"})
+		return
+	}
+	authorization := r.Header.Get("Authorization")
+	if s.AuthorizationToken != "" && subtle.ConstantTimeCompare([]byte(authorization), []byte(s.AuthorizationToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, &ECSError{Code: "Unauthorized", Message: "authorization token is not valid"})
+		return
+	}
+	profile := strings.TrimPrefix(r.URL.Path, "/")
+	if !s.served(profile) {
+		writeJSON(w, http.StatusNotFound, &ECSError{Code: "NotFound", Message: profile + " profile is not served"})
+		return
+	}
+	creds, err := s.Provider.Credentials(profile)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &ECSError{Code: "LoginFailed", Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, &ECSCredentials{
+		AccessKeyID:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		Token:           *creds.SessionToken,
+		Expiration:      formatTime(creds.Expiration),
+	})
+}
+
+func (s *ECS) served(profile string) bool {
+	for _, p := range s.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+)
+
+func createECSProvider(url string, token string) credentials.Provider {
+	config := defaults.Config()
+	handlers := defaults.Handlers()
+	return endpointcreds.NewProviderClient(*config, handlers, url, func(p *endpointcreds.Provider) {
+		p.Client.Handlers.Sign.PushBack(func(r *request.Request) {
+			r.HTTPRequest.Header.Set("Authorization", token)
+		})
+	})
+}
+
+func TestECS_SDKCredentials(t *testing.T) {
+	s := NewECS(&ProviderMock{Profile: "default"}, []string{"default"}, "authorization-token")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	creds, err := createECSProvider(ts.URL+"/default", "authorization-token").Retrieve()
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if creds.AccessKeyID != "access-key-id" {
+		t.Errorf("%s is not equal %s", creds.AccessKeyID, "access-key-id")
+	}
+	if creds.SessionToken != "session-token" {
+		t.Errorf("%s is not equal %s", creds.SessionToken, "session-token")
+	}
+}
+
+func TestECS_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		path     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "unauthorized",
+			provider: &ProviderMock{Profile: "default"},
+			path:     "/default",
+			token:    "invalid-token",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "not served",
+			provider: &ProviderMock{Profile: "default"},
+			path:     "/other",
+			token:    "authorization-token",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "login error",
+			provider: &ProviderMock{Error: errors.New("login error")},
+			path:     "/default",
+			token:    "authorization-token",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(NewECS(tt.provider, []string{"default"}, "authorization-token"))
+			defer ts.Close()
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			req.Header.Set("Authorization", tt.token)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("%v", err)
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantCode {
+				t.Errorf("%d is not equal %d", res.StatusCode, tt.wantCode)
+			}
+		})
+	}
+}
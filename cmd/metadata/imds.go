@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tokenPath              = "/latest/api/token"
+	securityCredentialPath = "/latest/meta-data/iam/security-credentials/"
+	regionPath             = "/latest/meta-data/placement/region"
+	availabilityZonePath   = "/latest/meta-data/placement/availability-zone"
+	identityDocumentPath   = "/latest/dynamic/instance-identity/document"
+	tokenHeader            = "X-Aws-Ec2-Metadata-Token"
+	tokenTTLHeader         = "X-Aws-Ec2-Metadata-Token-Ttl-Seconds"
+	maxTokenTTL            = 21600
+)
+
+// IMDS emulates EC2 instance metadata service for the instance profile credentials
+type IMDS struct {
+	Provider Provider
+	Profile  string
+	// RoleName is the instance profile role name, the profile name by default
+	RoleName string
+	Region   string
+	// RequireToken rejects IMDSv1 requests without a session token
+	RequireToken bool
+	mu           sync.Mutex
+	tokens       map[string]time.Time
+}
+
+// IMDSCredentials is the document of security-credentials/<role>
+type IMDSCredentials struct {
+	Code            string
+	LastUpdated     string
+	Type            string
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// NewIMDS creates an IMDS serving the profile
+func NewIMDS(provider Provider, profile string) *IMDS {
+	return &IMDS{
+		Provider: provider,
+		Profile:  profile,
+		RoleName: profile,
+		tokens:   map[string]time.Time{},
+	}
+}
+
+func (s *IMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == tokenPath {
+		s.serveToken(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == securityCredentialPath || r.URL.Path+"/" == securityCredentialPath:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, s.RoleName)
+	case r.URL.Path == securityCredentialPath+s.RoleName:
+		s.serveCredentials(w)
+	case r.URL.Path == regionPath && s.Region != "":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, s.Region)
+	case r.URL.Path == availabilityZonePath && s.Region != "":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, s.Region+"a")
+	case r.URL.Path == identityDocumentPath && s.Region != "":
+		writeJSON(w, http.StatusOK, map[string]string{"region": s.Region})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *IMDS) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ttl, err := strconv.Atoi(r.Header.Get(tokenTTLHeader))
+	if err != nil || ttl < 1 || ttl > maxTokenTTL {
+		http.Error(w, "invalid token ttl", http.StatusBadRequest)
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s.mu.Lock()
+	now := time.Now()
+	for t, expiration := range s.tokens {
+		if now.After(expiration) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = now.Add(time.Duration(ttl) * time.Second)
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set(tokenTTLHeader, strconv.Itoa(ttl))
+	fmt.Fprint(w, token)
+}
+
+// authorized reports whether the request has a valid token, or IMDSv1 is allowed
+func (s *IMDS) authorized(r *http.Request) bool {
+	token := r.Header.Get(tokenHeader)
+	if token == "" {
+		return !s.RequireToken
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiration, ok := s.tokens[token]
+	return ok && time.Now().Before(expiration)
+}
+
+func (s *IMDS) serveCredentials(w http.ResponseWriter) {
+	creds, err := s.Provider.Credentials(s.Profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	writeJSON(w, http.StatusOK, &IMDSCredentials{
+		Code:            "Success",
+		LastUpdated:     formatTime(&now),
+		Type:            "AWS-HMAC",
+		AccessKeyID:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		Token:           *creds.SessionToken,
+		Expiration:      formatTime(creds.Expiration),
+	})
+}
@@ -0,0 +1,141 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+type ProviderMock struct {
+	Profile string
+	Error   error
+}
+
+func (p *ProviderMock) Credentials(profile string) (*sts.Credentials, error) {
+	if p.Error != nil {
+		return nil, p.Error
+	}
+	if profile != p.Profile {
+		return nil, errors.Errorf("%s is not equal %s", profile, p.Profile)
+	}
+	expiration := time.Now().Add(time.Hour)
+	return &sts.Credentials{
+		AccessKeyId:     aws.String("access-key-id"),
+		SecretAccessKey: aws.String("secret-access-key"),
+		SessionToken:    aws.String("session-token"),
+		Expiration:      &expiration,
+	}, nil
+}
+
+func TestIMDS_SDKCredentials(t *testing.T) {
+	s := NewIMDS(&ProviderMock{Profile: "default"}, "default")
+	s.Region = "ap-northeast-1"
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession())
+	client := ec2metadata.New(sess, &aws.Config{Endpoint: aws.String(ts.URL + "/latest")})
+	provider := &ec2rolecreds.EC2RoleProvider{Client: client}
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if creds.AccessKeyID != "access-key-id" {
+		t.Errorf("%s is not equal %s", creds.AccessKeyID, "access-key-id")
+	}
+	if creds.SessionToken != "session-token" {
+		t.Errorf("%s is not equal %s", creds.SessionToken, "session-token")
+	}
+	region, err := client.Region()
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if region != "ap-northeast-1" {
+		t.Errorf("%s is not equal %s", region, "ap-northeast-1")
+	}
+}
+
+func TestIMDS_RequireToken(t *testing.T) {
+	s := NewIMDS(&ProviderMock{Profile: "default"}, "default")
+	s.RoleName = "role"
+	s.RequireToken = true
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("%d is not equal %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "0")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("%d is not equal %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	token, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/latest/meta-data/iam/security-credentials/", nil)
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "role" {
+		t.Errorf("%s is not equal %s", string(body), "role")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/latest/meta-data/iam/security-credentials/role", nil)
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), `"AccessKeyId":"access-key-id"`) {
+		t.Errorf("%s does not contain AccessKeyId", string(body))
+	}
+}
+
+func TestIMDS_ProviderError(t *testing.T) {
+	s := NewIMDS(&ProviderMock{Error: errors.New("login error")}, "default")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/latest/meta-data/iam/security-credentials/default")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("%d is not equal %d", res.StatusCode, http.StatusInternalServerError)
+	}
+}
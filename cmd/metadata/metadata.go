@@ -0,0 +1,30 @@
+package metadata
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Provider provides AWS credentials of the profile
+type Provider interface {
+	Credentials(profile string) (*sts.Credentials, error)
+}
+
+// timeFormat is the timestamp format of the credentials documents
+const timeFormat = "2006-01-02T15:04:05Z"
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(timeFormat)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
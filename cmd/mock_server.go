@@ -0,0 +1,109 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/mockserver"
+)
+
+var mockListenAddress string
+var mockScenario string
+var mockRoles []string
+var mockPendingPolls int
+var mockTLSCert string
+var mockTLSKey string
+var mockPrefix string
+
+// mockServerCmd represents the mock-server command
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Serve a mock OneLogin API and AWS STS for offline testing",
+	Long: `Mock-server fakes OneLogin Generate Tokens API, SAML assertion API v1 and v2
+and AWS STS AssumeRoleWithSAML on http://<listen>/sts with the scripted scenario.
+The server is mounted under --prefix to try the base URL with the path prefix.
+The SAML responses are signed, and only they are accepted by the fake STS.
+
+Point a service to the server with
+onelogin-aws-connector init --endpoint http://127.0.0.1:8180 --sts-endpoint http://127.0.0.1:8180/sts`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, err := newMockServer()
+		if err != nil {
+			errorExit(err)
+		}
+		scheme := "http"
+		if mockTLSCert != "" {
+			scheme = "https"
+		}
+		base := fmt.Sprintf("%s://%s%s", scheme, mockListenAddress, server.Prefix)
+		logging.Info("mock OneLogin server is listening", logging.F("address", mockListenAddress), logging.F("scenario", server.Scenario))
+		fmt.Fprintf(os.Stderr, "onelogin-aws-connector init --endpoint %s --sts-endpoint %s/sts --client-token %s --client-secret %s --subdomain mock --username-or-email %s\n",
+			base, base, server.ClientToken, server.ClientSecret, server.UsernameOrEmail)
+		fmt.Fprintf(os.Stderr, "password: %s, OTP token: %s\n", server.Password, server.OTPToken)
+		if mockTLSCert != "" {
+			err = http.ListenAndServeTLS(mockListenAddress, mockTLSCert, mockTLSKey, server)
+		} else {
+			err = http.ListenAndServe(mockListenAddress, server)
+		}
+		if err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mockServerCmd)
+	mockServerCmd.Flags().StringVarP(&mockListenAddress, "listen", "", "127.0.0.1:8180", "Address to listen on")
+	mockServerCmd.Flags().StringVarP(&mockScenario, "scenario", "", string(mockserver.NoMFA), "Scenario of the server ("+strings.Join(mockserver.Scenarios, ", ")+")")
+	mockServerCmd.Flags().StringArrayVarP(&mockRoles, "role", "", nil, "AWS role in the SAML responses as \"role-arn,provider-arn\" (default Admin and ReadOnly roles of 123456789012)")
+	mockServerCmd.Flags().IntVarP(&mockPendingPolls, "pending-polls", "", mockserver.DefaultPendingPolls, "Number of the verify factor requests pending before the push notification is approved or denied")
+	mockServerCmd.Flags().StringVarP(&mockTLSCert, "tls-cert", "", "", "Certificate file to serve HTTPS, which is trusted by init --ca-bundle")
+	mockServerCmd.Flags().StringVarP(&mockTLSKey, "tls-key", "", "", "Private key file of --tls-cert")
+	mockServerCmd.Flags().StringVarP(&mockPrefix, "prefix", "", "", "Path prefix to mount the server under such as /onelogin")
+}
+
+func newMockServer() (*mockserver.Server, error) {
+	if (mockTLSCert == "") != (mockTLSKey == "") {
+		return nil, errors.Errorf("--tls-cert and --tls-key are required together")
+	}
+	server, err := mockserver.New(mockserver.Scenario(mockScenario))
+	if err != nil {
+		return nil, err
+	}
+	server.PendingPolls = mockPendingPolls
+	if mockPrefix != "" {
+		server.Prefix = "/" + strings.Trim(mockPrefix, "/")
+	}
+	if len(mockRoles) > 0 {
+		server.Roles = []saml.Role{}
+		for _, value := range mockRoles {
+			role, err := saml.ParseRole(value)
+			if err != nil {
+				return nil, err
+			}
+			server.Roles = append(server.Roles, role)
+		}
+	}
+	return server, nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/mockserver"
+)
+
+func resetMockServerFlags() {
+	mockScenario = string(mockserver.NoMFA)
+	mockRoles = nil
+	mockPendingPolls = mockserver.DefaultPendingPolls
+	mockTLSCert = ""
+	mockTLSKey = ""
+	mockPrefix = ""
+}
+
+func TestNewMockServer(t *testing.T) {
+	resetMockServerFlags()
+	defer resetMockServerFlags()
+	mockScenario = string(mockserver.Push)
+	mockRoles = []string{"arn:aws:iam::210987654321:saml-provider/OneLogin,arn:aws:iam::210987654321:role/Developer"}
+	mockPendingPolls = 5
+	mockPrefix = "onelogin/"
+	server, err := newMockServer()
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if server.Scenario != mockserver.Push {
+		t.Errorf("%s is not equal %s", server.Scenario, mockserver.Push)
+	}
+	if server.PendingPolls != 5 {
+		t.Errorf("%d is not equal %d", server.PendingPolls, 5)
+	}
+	if server.Prefix != "/onelogin" {
+		t.Errorf("%s is not equal %s", server.Prefix, "/onelogin")
+	}
+	if len(server.Roles) != 1 || server.Roles[0].RoleArn != "arn:aws:iam::210987654321:role/Developer" {
+		t.Errorf("%v is not Developer role", server.Roles)
+	}
+}
+
+func TestNewMockServerError(t *testing.T) {
+	resetMockServerFlags()
+	defer resetMockServerFlags()
+	mockScenario = "unknown"
+	if _, err := newMockServer(); err == nil {
+		t.Error("It need to return unsupported scenario error.")
+	}
+	resetMockServerFlags()
+	mockRoles = []string{"arn:aws:iam::210987654321:role/Developer"}
+	if _, err := newMockServer(); err == nil {
+		t.Error("It need to return invalid role error.")
+	}
+	resetMockServerFlags()
+	mockTLSCert = "cert.pem"
+	if _, err := newMockServer(); err == nil {
+		t.Error("It need to return missing --tls-key error.")
+	}
+}
@@ -0,0 +1,169 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the format of the command output
+type Format string
+
+const (
+	// Text is the plain text for humans
+	Text Format = "text"
+	// JSON is the indented JSON document
+	JSON Format = "json"
+	// YAML is the YAML document
+	YAML Format = "yaml"
+)
+
+// Formats are the names of the supported formats
+var Formats = []string{string(Text), string(JSON), string(YAML)}
+
+// Parse returns the format of the name
+func Parse(name string) (Format, error) {
+	for _, f := range Formats {
+		if f == name {
+			return Format(name), nil
+		}
+	}
+	return "", errors.Errorf("%s is not supported output format (%s)", name, strings.Join(Formats, ", "))
+}
+
+// Write writes the value in the format, and text writes it in the text format.
+// The value is encoded with the json tags of the fields in JSON and YAML.
+func Write(w io.Writer, format Format, v interface{}, text func(w io.Writer) error) error {
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case YAML:
+		return writeYAML(w, v)
+	default:
+		if text == nil {
+			return nil
+		}
+		return text(w)
+	}
+}
+
+// writeYAML writes the value as the JSON compatible YAML document.
+// The keys of the objects are sorted like JSON encoding of maps.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	var b strings.Builder
+	encodeYAML(&b, value, 0)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func encodeYAML(b *strings.Builder, value interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+	if !nested(value) {
+		b.WriteString(prefix + scalarYAML(value) + "\n")
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(prefix + scalarYAML(key) + ":")
+			encodeNested(b, v[key], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !nested(item) {
+				b.WriteString(prefix + "- " + scalarYAML(item) + "\n")
+				continue
+			}
+			// the first line of the nested item follows the hyphen
+			var child strings.Builder
+			encodeYAML(&child, item, indent+1)
+			b.WriteString(prefix + "- " + strings.TrimPrefix(child.String(), prefix+"  "))
+		}
+	}
+}
+
+// encodeNested writes the value following the key
+func encodeNested(b *strings.Builder, value interface{}, indent int) {
+	if !nested(value) {
+		b.WriteString(" " + scalarYAML(value) + "\n")
+		return
+	}
+	b.WriteString("\n")
+	encodeYAML(b, value, indent+1)
+}
+
+// nested returns true if the value is the non-empty object or array written in the lines
+func nested(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+func scalarYAML(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if plainYAML(v) {
+			return v
+		}
+		// the double quoted JSON string is also the YAML string
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// plainYAML returns true if the string can be written without the quotes
+func plainYAML(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return false
+	}
+	// the strings starting with the digit may be read as the numbers or the timestamps
+	if strings.ContainsAny(s[:1], "0123456789-?:,[]{}#&*!|>'\"%@`.") {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return !strings.Contains(s, ": ") && !strings.Contains(s, " #")
+}
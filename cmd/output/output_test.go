@@ -0,0 +1,114 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type document struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Enabled bool              `json:"enabled"`
+	Tags    map[string]string `json:"tags"`
+	Items   []item            `json:"items"`
+	Empty   []string          `json:"empty"`
+	Missing *string           `json:"missing"`
+}
+
+type item struct {
+	ID   string `json:"id"`
+	Note string `json:"note"`
+}
+
+var doc = &document{
+	Name:    "example",
+	Count:   3,
+	Enabled: true,
+	Tags:    map[string]string{"b": "2019-01-01T00:00:00Z", "a": "yes"},
+	Items: []item{
+		{ID: "arn:aws:iam::123456789012:role/Admin", Note: "key: value"},
+		{ID: "0123", Note: ""},
+	},
+	Empty: []string{},
+}
+
+func TestParse(t *testing.T) {
+	for _, name := range Formats {
+		if f, err := Parse(name); err != nil || string(f) != name {
+			t.Errorf("%s is not parsed: %v", name, err)
+		}
+	}
+	if _, err := Parse("xml"); err == nil {
+		t.Error("It need to return unsupported format error.")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{
+			format: Text,
+			want:   "example\n",
+		},
+		{
+			format: JSON,
+			want: `{
+  "name": "example",
+  "count": 3,
+  "enabled": true,
+  "tags": {
+    "a": "yes",
+    "b": "2019-01-01T00:00:00Z"
+  },
+  "items": [
+    {
+      "id": "arn:aws:iam::123456789012:role/Admin",
+      "note": "key: value"
+    },
+    {
+      "id": "0123",
+      "note": ""
+    }
+  ],
+  "empty": [],
+  "missing": null
+}
+`,
+		},
+		{
+			format: YAML,
+			want: `count: 3
+empty: []
+enabled: true
+items:
+  - id: arn:aws:iam::123456789012:role/Admin
+    note: "key: value"
+  - id: "0123"
+    note: ""
+missing: null
+name: example
+tags:
+  a: "yes"
+  b: "2019-01-01T00:00:00Z"
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Write(&buf, tt.format, doc, func(w io.Writer) error {
+				_, err := io.WriteString(w, doc.Name+"\n")
+				return err
+			})
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("%s is not equal %s", buf.String(), tt.want)
+			}
+		})
+	}
+}
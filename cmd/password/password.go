@@ -0,0 +1,179 @@
+package password
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+)
+
+// Source provides a OneLogin password or MFA token without a terminal
+type Source interface {
+	Password() (string, error)
+}
+
+// Store is the secret store read by Keyring
+var Store secret.Store
+
+// Env reads the password from the environment variable
+type Env string
+
+// File reads the password from the file
+type File string
+
+// Command reads the password from the standard output of the command
+type Command string
+
+// FD reads the password from the file descriptor inherited from the parent
+type FD int
+
+// Keyring reads the password from the secret store
+type Keyring string
+
+// TOTP computes the time-based one-time password from the secret of the source
+type TOTP struct {
+	Secret Source
+	Now    func() time.Time
+}
+
+// Parse creates a Source from "env:NAME", "file:PATH", "command:COMMAND", "fd:N",
+// "keyring:KEY" or "totp:SOURCE" of the TOTP secret
+func Parse(spec string) (Source, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, errors.Errorf("%s is not valid password source", spec)
+	}
+	kind, value := spec[:i], spec[i+1:]
+	if value == "" {
+		return nil, errors.Errorf("%s is not valid password source", spec)
+	}
+	switch kind {
+	case "env":
+		return Env(value), nil
+	case "file":
+		return File(value), nil
+	case "command":
+		return Command(value), nil
+	case "fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return nil, errors.Errorf("%s is not valid file descriptor", value)
+		}
+		return FD(fd), nil
+	case "keyring":
+		return Keyring(value), nil
+	case "totp":
+		source, err := Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return &TOTP{Secret: source, Now: time.Now}, nil
+	}
+	return nil, errors.Errorf("%s is not supported password source", kind)
+}
+
+// Password returns the value of the environment variable
+func (e Env) Password() (string, error) {
+	value, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", errors.Errorf("%s environment variable is not exists", string(e))
+	}
+	return value, nil
+}
+
+// Password returns the first line of the file
+func (f File) Password() (string, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+	return firstLine(data), nil
+}
+
+// Password returns the first line of the command output
+func (c Command) Password() (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", string(c))
+	} else {
+		cmd = exec.Command("sh", "-c", string(c))
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrap(err, "password command failed")
+	}
+	return firstLine(out), nil
+}
+
+// files keeps the files of the file descriptors open not to be closed by the finalizer
+var files = map[FD]*os.File{}
+
+// Password returns the next line read from the file descriptor.
+// The line is read byte by byte to leave the following lines for the other sources.
+func (f FD) Password() (string, error) {
+	file, ok := files[f]
+	if !ok {
+		file = os.NewFile(uintptr(f), "fd")
+		if file == nil {
+			return "", errors.Errorf("%d is not valid file descriptor", int(f))
+		}
+		files[f] = file
+	}
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := file.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return "", errors.Wrapf(err, "failed to read file descriptor %d", int(f))
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+// Password returns the secret in the secret store
+func (k Keyring) Password() (string, error) {
+	if Store == nil {
+		return "", errors.Errorf("keyring source requires a secret store")
+	}
+	value, err := Store.Get(string(k))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s from the secret store", string(k))
+	}
+	return value, nil
+}
+
+// Password returns the current code
+func (t *TOTP) Password() (string, error) {
+	s, err := t.Secret.Password()
+	if err != nil {
+		return "", err
+	}
+	return totp.Code(s, t.Now())
+}
+
+func firstLine(data []byte) string {
+	s := string(data)
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
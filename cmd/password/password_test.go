@@ -0,0 +1,179 @@
+package password
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Source
+		wantErr bool
+	}{
+		{name: "env", spec: "env:PASSWORD", want: Env("PASSWORD")},
+		{name: "file", spec: "file:/tmp/password", want: File("/tmp/password")},
+		{name: "command", spec: "command:pass show onelogin", want: Command("pass show onelogin")},
+		{name: "fd", spec: "fd:3", want: FD(3)},
+		{name: "keyring", spec: "keyring:password", want: Keyring("password")},
+		{name: "invalid fd", spec: "fd:stdin", wantErr: true},
+		{name: "invalid totp", spec: "totp:SECRET", wantErr: true},
+		{name: "no kind", spec: "PASSWORD", wantErr: true},
+		{name: "empty value", spec: "env:", wantErr: true},
+		{name: "unknown kind", spec: "unknown:PASSWORD", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnv_Password(t *testing.T) {
+	os.Setenv("ONELOGIN_AWS_CONNECTOR_TEST_PASSWORD", "password")
+	defer os.Unsetenv("ONELOGIN_AWS_CONNECTOR_TEST_PASSWORD")
+	got, err := Env("ONELOGIN_AWS_CONNECTOR_TEST_PASSWORD").Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+	if _, err := Env("ONELOGIN_AWS_CONNECTOR_TEST_NONE").Password(); err == nil {
+		t.Error("It need to return not exists error.")
+	}
+}
+
+func TestFile_Password(t *testing.T) {
+	fd, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	defer os.Remove(fd.Name())
+	fd.WriteString("password\nsecond line\n")
+	fd.Close()
+	got, err := File(fd.Name()).Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+}
+
+func TestCommand_Password(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	got, err := Command("echo password").Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+	if _, err := Command("exit 1").Password(); err == nil {
+		t.Error("It need to return command error.")
+	}
+}
+
+func TestFD_Password(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer r.Close()
+	w.WriteString("password\nsecond line\n")
+	w.Close()
+	fd := FD(r.Fd())
+	got, err := fd.Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+	got, err = fd.Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "second line" {
+		t.Errorf("%s is not equal %s", got, "second line")
+	}
+	if _, err := fd.Password(); err == nil {
+		t.Error("It need to return EOF error.")
+	}
+}
+
+type StoreMock map[string]string
+
+func (s StoreMock) Get(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", secret.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s StoreMock) Set(key string, value string) error {
+	s[key] = value
+	return nil
+}
+
+func (s StoreMock) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestKeyring_Password(t *testing.T) {
+	if _, err := Keyring("password").Password(); err == nil {
+		t.Error("It need to return no secret store error.")
+	}
+	Store = StoreMock{"password": "password"}
+	defer func() {
+		Store = nil
+	}()
+	got, err := Keyring("password").Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+	if _, err := Keyring("none").Password(); err == nil {
+		t.Error("It need to return not exists error.")
+	}
+}
+
+func TestTOTP_Password(t *testing.T) {
+	os.Setenv("ONELOGIN_AWS_CONNECTOR_TEST_SEED", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	defer os.Unsetenv("ONELOGIN_AWS_CONNECTOR_TEST_SEED")
+	source, err := Parse("totp:env:ONELOGIN_AWS_CONNECTOR_TEST_SEED")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	source.(*TOTP).Now = func() time.Time {
+		return time.Unix(59, 0)
+	}
+	got, err := source.Password()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "287082" {
+		t.Errorf("%s is not equal %s", got, "287082")
+	}
+}
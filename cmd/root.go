@@ -17,17 +17,40 @@ package cmd
 import (
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/output"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/password"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
 )
 
 var (
-	awsProfile string
-	debug      bool
-	configFile string
-	cacheDir   string
-	awsDir     string
+	awsProfile   string
+	debug        bool
+	configFile   string
+	cacheDir     string
+	awsDir       string
+	daemonSocket string
+	secrets      secret.Store
+	caches       secret.Store
+
+	passwordSourceSpec string
+	otpSourceSpec      string
+	mfaDevice          string
+	outputName         string
+	outputFormat       = output.Text
+	logLevelName       string
+	debugSecrets       bool
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -36,13 +59,45 @@ var RootCmd = &cobra.Command{
 	Short: "Generate AWS Credentials with OneLogin SAML",
 	Long: `This is a CLI command to generate AWS credentials with OneLogin SAML
 This command write to credentials to ~/.aws/config and ~/.aws/credentials.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		format, err := output.Parse(outputName)
+		if err != nil {
+			errorExit(failure.Wrap(failure.Usage, err))
+		}
+		outputFormat = format
+		if outputFormat != output.Text {
+			// the prompts do not break the document on stdout
+			promptOutput = os.Stderr
+		}
+		if err := configureLogging(logLevelName, debug, debugSecrets); err != nil {
+			errorExit(failure.Wrap(failure.Usage, err))
+		}
+	},
+}
+
+// openStores opens the secret store, the caches and the sources of the password and the MFA token.
+// It is PreRun of the commands using them, so the other commands such as version never ask the passphrase.
+func openStores(cmd *cobra.Command, args []string) {
+	if err := openSecretStore(configFile, true); err != nil {
+		errorExit(failure.Wrap(failure.Config, err))
+	}
+	if err := openSources(passwordSourceSpec, otpSourceSpec); err != nil {
+		errorExit(failure.Wrap(failure.Usage, err))
+	}
+}
+
+// openStoresReadOnly opens the secret store and the caches to read them, without migrating or removing the caches
+func openStoresReadOnly(cmd *cobra.Command, args []string) {
+	if err := openSecretStore(configFile, false); err != nil {
+		errorExit(failure.Wrap(failure.Config, err))
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
-		errorExit(err)
+		errorExit(failure.Wrap(failure.Usage, err))
 	}
 }
 
@@ -70,6 +125,123 @@ func init() {
 		}
 	}
 	configFile = path.Join(dir, "config.toml")
+	daemonSocket = path.Join(dir, "daemon.sock")
 	awsProfile = os.Getenv("AWS_PROFILE")
-	RootCmd.PersistentFlags().BoolVarP(&debug, "debug", "", false, "debug mode")
+	RootCmd.PersistentFlags().BoolVarP(&debug, "debug", "", false, "debug mode, which is --log-level debug with the secrets redacted")
+	RootCmd.PersistentFlags().BoolVarP(&debugSecrets, "debug-secrets", "", false, "debug mode printing the secrets such as the password and the tokens, never share the logs")
+	RootCmd.PersistentFlags().StringVarP(&logLevelName, "log-level", "", envOrDefault("ONELOGIN_AWS_CONNECTOR_LOG_LEVEL", logging.InfoLevel.String()), "Level of the logs on stderr ("+strings.Join(logging.Levels, ", ")+")")
+	RootCmd.PersistentFlags().StringVarP(&outputName, "output", "", envOrDefault("ONELOGIN_AWS_CONNECTOR_OUTPUT", string(output.Text)), "Output format of the results and the errors ("+strings.Join(output.Formats, ", ")+")")
+	RootCmd.PersistentFlags().StringVarP(&passwordSourceSpec, "password-source", "", os.Getenv("ONELOGIN_AWS_CONNECTOR_PASSWORD_SOURCE"), "Source of OneLogin password (env:NAME, file:PATH, command:COMMAND, fd:N or keyring:KEY)")
+	RootCmd.PersistentFlags().StringVarP(&mfaDevice, "mfa-device", "", "", "MFA device type or ID selected without the prompt, init and configure save it as the preference of the service and the profile")
+	RootCmd.PersistentFlags().DurationVarP(&loginTimeout, "timeout", "", 5*time.Minute, "Timeout of the whole login including MFA approval, 0 means no timeout")
+	RootCmd.PersistentFlags().DurationVarP(&requestTimeout, "request-timeout", "", 30*time.Second, "Timeout of each OneLogin API request, 0 means no timeout")
+	RootCmd.PersistentFlags().StringVarP(&otpSourceSpec, "otp-source", "", os.Getenv("ONELOGIN_AWS_CONNECTOR_OTP_SOURCE"), "Source of MFA token (env:NAME, file:PATH, command:COMMAND, fd:N, keyring:KEY or totp:SOURCE of TOTP secret)")
+}
+
+// configureLogging sets the level of the logs, and --debug-secrets stops the redaction of the secrets
+func configureLogging(levelName string, debug bool, secrets bool) error {
+	level, err := logging.ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	if debug || secrets {
+		level = logging.DebugLevel
+	}
+	logging.SetLevel(level)
+	logging.ShowSecrets(secrets)
+	if secrets {
+		logging.Warn("the secrets are printed in the debug logs, do not share them")
+	}
+	return nil
+}
+
+// envOrDefault returns the environment variable, or the value if it is empty
+func envOrDefault(name string, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return value
+}
+
+// openSecretStore opens the secret store and the caches configured in the config file,
+// and the caches of the previous configuration are migrated if migrate is set
+func openSecretStore(file string, migrate bool) error {
+	c, err := config.Load(file)
+	if err != nil {
+		return err
+	}
+	store, err := secret.New(c.SecretStore, path.Dir(file))
+	if err != nil {
+		return err
+	}
+	useSecretStore(store)
+	return openCaches(c.CacheEncryption, store, migrate)
+}
+
+// useSecretStore makes the store read by the password sources and the TOTP registry
+func useSecretStore(store secret.Store) {
+	secrets = store
+	password.Store = store
+	totpRegistry = nil
+	if store != nil {
+		totpRegistry = totp.NewRegistry(store)
+	}
+}
+
+// openCaches encrypts the caches with the encryption, or keeps them in the store if it is "none".
+// The caches of the previous configuration are migrated or removed only if migrate is set.
+func openCaches(encryption string, store secret.Store, migrate bool) error {
+	cache, err := secret.NewCache(encryption, cacheDir, store)
+	if err != nil {
+		return err
+	}
+	caches = store
+	if cache != nil {
+		if migrate {
+			if err := cache.Migrate(); err != nil {
+				return err
+			}
+		}
+		caches = cache
+	} else if store != nil && migrate {
+		// the plaintext caches of the previous versions are not used with the secret store
+		if err := removeCaches(cacheDir); err != nil {
+			return err
+		}
+	}
+	onelogin.Store = caches
+	return nil
+}
+
+// removeCaches removes the cache files in the directory
+func removeCaches(dir string) error {
+	files, err := filepath.Glob(path.Join(dir, "*.cache"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openSources parses the password and MFA token sources used instead of the terminal
+func openSources(passwordSpec string, otpSpec string) error {
+	if passwordSpec != "" {
+		source, err := password.Parse(passwordSpec)
+		if err != nil {
+			return err
+		}
+		passwordSource = source
+	}
+	if otpSpec != "" {
+		source, err := password.Parse(otpSpec)
+		if err != nil {
+			return err
+		}
+		otpSource = source
+	}
+	return nil
 }
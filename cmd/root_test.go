@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	defer configureLogging("info", false, false)
+	tests := []struct {
+		name    string
+		level   string
+		debug   bool
+		secrets bool
+		want    logging.Level
+		wantErr bool
+	}{
+		{name: "level", level: "warn", want: logging.WarnLevel},
+		{name: "debug", level: "info", debug: true, want: logging.DebugLevel},
+		{name: "debug secrets", level: "error", secrets: true, want: logging.DebugLevel},
+		{name: "unsupported", level: "trace", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := configureLogging(tt.level, tt.debug, tt.secrets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configureLogging() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !logging.Enabled(tt.want) || (tt.want > logging.DebugLevel && logging.Enabled(tt.want-1)) {
+				t.Errorf("%v is not enabled as the lowest level", tt.want)
+			}
+		})
+	}
+}
+
+func TestRootCmdOpenStores(t *testing.T) {
+	// the commands without the secrets never ask the passphrase or the keyring
+	for _, cmd := range []*cobra.Command{versionCmd, mockServerCmd} {
+		if cmd.PreRun != nil {
+			t.Errorf("%s opens the secret store", cmd.Name())
+		}
+	}
+	for _, cmd := range []*cobra.Command{loginCmd, credentialProcessCmd, daemonCmd, totpAddCmd} {
+		if cmd.PreRun == nil {
+			t.Errorf("%s does not open the secret store", cmd.Name())
+		}
+	}
+}
+
+func TestRootCmdOpenCachesReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	original := cacheDir
+	cacheDir = dir
+	defer func() {
+		cacheDir = original
+		caches = nil
+		onelogin.Store = nil
+	}()
+	file := path.Join(dir, "aws.default.cache")
+	if err := ioutil.WriteFile(file, []byte("{}"), 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	// status only reads the caches, and the plaintext caches are not removed
+	if err := openCaches("", StoreMock{}, false); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := openCaches("", StoreMock{}, true); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("the plaintext cache is not removed.")
+	}
+}
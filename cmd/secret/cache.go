@@ -0,0 +1,298 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The encrypted cache file is
+//
+//   magic | version | kdf | salt | nonce | XChaCha20-Poly1305 sealed data
+//
+// and the header is authenticated as the additional data.
+const (
+	cacheMagic   = "OLACENC"
+	cacheVersion = 1
+	cacheSalt    = 16
+	cacheHeader  = len(cacheMagic) + 2 + cacheSalt + chacha20poly1305.NonceSizeX
+)
+
+// KDF is how the key of the encrypted cache file is derived
+type KDF byte
+
+const (
+	// KDFKey uses the random key held in the secret store as it is
+	KDFKey KDF = iota
+	// KDFScrypt derives the key from the passphrase with the salt of the file
+	KDFScrypt
+)
+
+// CacheKeyName is the name of the key of the encrypted cache files in the secret store
+const CacheKeyName = "cache.key"
+
+// Encryptions are the names of the supported cache encryptions
+var Encryptions = []string{"none", "passphrase", "keyring"}
+
+// Cache stores the secrets in the encrypted files in the directory
+type Cache struct {
+	Dir        string
+	KDF        KDF
+	Passphrase func() (string, error)
+	Key        func() ([]byte, error)
+
+	mu         sync.Mutex
+	keys       map[string][]byte
+	passphrase *string
+}
+
+// NewCache creates the Cache of the encryption, or nil for "none".
+// The "keyring" encryption holds the key in the store.
+func NewCache(encryption string, dir string, store Store) (*Cache, error) {
+	switch encryption {
+	case "", "none":
+		return nil, nil
+	case "passphrase":
+		return NewPassphraseCache(dir, cachePassphrase), nil
+	case "keyring":
+		if store == nil {
+			return nil, errors.Errorf("keyring cache encryption requires a secret store")
+		}
+		return NewKeyCache(dir, StoredKey(store)), nil
+	}
+	return nil, errors.Errorf("%s is not supported cache encryption", encryption)
+}
+
+// NewPassphraseCache creates a Cache encrypted with the key derived from the passphrase
+func NewPassphraseCache(dir string, passphrase func() (string, error)) *Cache {
+	return &Cache{
+		Dir:        dir,
+		KDF:        KDFScrypt,
+		Passphrase: passphrase,
+		keys:       map[string][]byte{},
+	}
+}
+
+// NewKeyCache creates a Cache encrypted with the key
+func NewKeyCache(dir string, key func() ([]byte, error)) *Cache {
+	return &Cache{
+		Dir:  dir,
+		KDF:  KDFKey,
+		Key:  key,
+		keys: map[string][]byte{},
+	}
+}
+
+// StoredKey returns the random key held in the store, generating it at the first time
+func StoredKey(store Store) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		encoded, err := store.Get(CacheKeyName)
+		if err == nil {
+			return base64.StdEncoding.DecodeString(encoded)
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+		key := make([]byte, chacha20poly1305.KeySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if err := store.Set(CacheKeyName, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// Get decrypts the cache file.
+// The file encrypted with the other KDF is not exists since it is only a cache.
+func (c *Cache) Get(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if !encrypted(data) || KDF(data[len(cacheMagic)+1]) != c.KDF {
+		return "", ErrNotFound
+	}
+	plain, err := c.open(key, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Set encrypts the cache file
+func (c *Cache) Set(key string, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seal(key, []byte(value))
+}
+
+// Delete removes the cache file
+func (c *Cache) Delete(key string) error {
+	if err := os.Remove(c.file(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Migrate encrypts the plaintext cache files and the files of the older versions.
+// The key is not required if there is nothing to migrate.
+func (c *Cache) Migrate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || path.Ext(f.Name()) != ".cache" {
+			continue
+		}
+		data, err := ioutil.ReadFile(c.file(f.Name()))
+		if err != nil {
+			return err
+		}
+		if encrypted(data) && data[len(cacheMagic)] == cacheVersion {
+			continue
+		}
+		plain := data
+		if encrypted(data) {
+			if plain, err = c.open(f.Name(), data); err != nil {
+				return errors.Wrapf(err, "failed to migrate %s", f.Name())
+			}
+		}
+		if err := c.seal(f.Name(), plain); err != nil {
+			return errors.Wrapf(err, "failed to migrate %s", f.Name())
+		}
+	}
+	return nil
+}
+
+func (c *Cache) file(key string) string {
+	return path.Join(c.Dir, key)
+}
+
+func encrypted(data []byte) bool {
+	return len(data) >= cacheHeader && string(data[:len(cacheMagic)]) == cacheMagic
+}
+
+func (c *Cache) open(key string, data []byte) ([]byte, error) {
+	if version := data[len(cacheMagic)]; version != cacheVersion {
+		return nil, errors.Errorf("%s is unsupported cache version %d", key, version)
+	}
+	kdf := KDF(data[len(cacheMagic)+1])
+	salt := data[len(cacheMagic)+2 : len(cacheMagic)+2+cacheSalt]
+	nonce := data[len(cacheMagic)+2+cacheSalt : cacheHeader]
+	aead, err := c.aead(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data[cacheHeader:], data[:cacheHeader])
+	if err != nil {
+		return nil, errors.Errorf("failed to decrypt %s, the key may be wrong", key)
+	}
+	return plain, nil
+}
+
+func (c *Cache) seal(key string, plain []byte) error {
+	header := make([]byte, cacheHeader)
+	copy(header, cacheMagic)
+	header[len(cacheMagic)] = cacheVersion
+	header[len(cacheMagic)+1] = byte(c.KDF)
+	salt := header[len(cacheMagic)+2 : len(cacheMagic)+2+cacheSalt]
+	if c.KDF == KDFScrypt {
+		// the salt is shared in the process not to derive the key on every write
+		if s, ok := c.salt(); ok {
+			copy(salt, s)
+		} else if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+	}
+	if _, err := io.ReadFull(rand.Reader, header[len(cacheMagic)+2+cacheSalt:]); err != nil {
+		return err
+	}
+	aead, err := c.aead(c.KDF, salt)
+	if err != nil {
+		return err
+	}
+	nonce := header[len(cacheMagic)+2+cacheSalt:]
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.Write(aead.Seal(nil, nonce, plain, header))
+	return ioutil.WriteFile(c.file(key), buf.Bytes(), 0600)
+}
+
+// salt returns a salt whose key is already derived
+func (c *Cache) salt() ([]byte, bool) {
+	for s := range c.keys {
+		if s != "" {
+			return []byte(s), true
+		}
+	}
+	return nil, false
+}
+
+// aead returns the cipher of the KDF and the salt, deriving the key only once
+func (c *Cache) aead(kdf KDF, salt []byte) (cipher.AEAD, error) {
+	memo := ""
+	if kdf == KDFScrypt {
+		memo = string(salt)
+	}
+	key, ok := c.keys[memo]
+	if !ok {
+		var err error
+		switch kdf {
+		case KDFKey:
+			if c.Key == nil {
+				return nil, errors.Errorf("cache is not encrypted with the keyring key")
+			}
+			key, err = c.Key()
+		case KDFScrypt:
+			if c.Passphrase == nil {
+				return nil, errors.Errorf("cache is not encrypted with the passphrase")
+			}
+			var passphrase string
+			if passphrase, err = c.readPassphrase(); err == nil {
+				key, err = scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+			}
+		default:
+			return nil, errors.Errorf("%d is unsupported cache kdf", kdf)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.keys[memo] = key
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// readPassphrase asks the passphrase only once, since the files written by the other processes have their own salts
+func (c *Cache) readPassphrase() (string, error) {
+	if c.passphrase == nil {
+		passphrase, err := c.Passphrase()
+		if err != nil {
+			return "", err
+		}
+		c.passphrase = &passphrase
+	}
+	return *c.passphrase, nil
+}
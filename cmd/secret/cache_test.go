@@ -0,0 +1,212 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+type StoreMock map[string]string
+
+func (s StoreMock) Get(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (s StoreMock) Set(key string, value string) error {
+	s[key] = value
+	return nil
+}
+
+func (s StoreMock) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache func(dir string) *Cache
+	}{
+		{
+			name: "passphrase",
+			cache: func(dir string) *Cache {
+				return NewPassphraseCache(dir, passphrase("passphrase"))
+			},
+		},
+		{
+			name: "keyring",
+			cache: func(dir string) *Cache {
+				return NewKeyCache(dir, StoredKey(StoreMock{}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			c := tt.cache(dir)
+			if _, err := c.Get("aws.test.cache"); err != ErrNotFound {
+				t.Errorf("%v is not equal %v", err, ErrNotFound)
+			}
+			if err := c.Set("aws.test.cache", `SessionToken = "session-token"`); err != nil {
+				t.Errorf("%#v", err)
+			}
+			data, err := ioutil.ReadFile(path.Join(dir, "aws.test.cache"))
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			if strings.Contains(string(data), "session-token") {
+				t.Error("the cache is written in plaintext")
+			}
+			value, err := c.Get("aws.test.cache")
+			if err != nil {
+				t.Errorf("%#v", err)
+			}
+			if value != `SessionToken = "session-token"` {
+				t.Errorf("%s is not equal %s", value, `SessionToken = "session-token"`)
+			}
+
+			// the header is authenticated, and the same cache is used so the key is right
+			data[len(cacheMagic)+2] ^= 1
+			if err := ioutil.WriteFile(path.Join(dir, "aws.test.cache"), data, 0600); err != nil {
+				t.Fatalf("%#v", err)
+			}
+			if _, err := c.Get("aws.test.cache"); err == nil {
+				t.Error("It need to return decrypt error.")
+			}
+			if err := c.Delete("aws.test.cache"); err != nil {
+				t.Errorf("%#v", err)
+			}
+			if _, err := c.Get("aws.test.cache"); err != ErrNotFound {
+				t.Errorf("%v is not equal %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestCacheWrongPassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := NewPassphraseCache(dir, passphrase("passphrase")).Set("aws.test.cache", "value"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := NewPassphraseCache(dir, passphrase("wrong")).Get("aws.test.cache"); err == nil {
+		t.Error("It need to return decrypt error.")
+	}
+	// the cache encrypted with the other key source is regarded as not exists
+	if _, err := NewKeyCache(dir, StoredKey(StoreMock{})).Get("aws.test.cache"); err != ErrNotFound {
+		t.Errorf("%v is not equal %v", err, ErrNotFound)
+	}
+}
+
+func TestCacheMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "aws.test.cache"), []byte("plaintext"), 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "other.txt"), []byte("other"), 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+
+	called := 0
+	c := NewPassphraseCache(dir, func() (string, error) {
+		called++
+		return "passphrase", nil
+	})
+	if err := c.Migrate(); err != nil {
+		t.Errorf("%#v", err)
+	}
+	value, err := c.Get("aws.test.cache")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "plaintext" {
+		t.Errorf("%s is not equal %s", value, "plaintext")
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "other.txt"))
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if string(data) != "other" {
+		t.Errorf("%s is not equal %s", string(data), "other")
+	}
+
+	// nothing to migrate does not ask the passphrase
+	c = NewPassphraseCache(dir, func() (string, error) {
+		called++
+		return "passphrase", nil
+	})
+	if err := c.Migrate(); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if called != 1 {
+		t.Errorf("%d is not equal %d", called, 1)
+	}
+}
+
+func TestCachePassphraseOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the files are written by the processes with their own salts
+	for _, key := range []string{"aws.default.cache", "aws.other.cache"} {
+		if err := NewPassphraseCache(dir, passphrase("passphrase")).Set(key, key); err != nil {
+			t.Fatalf("%#v", err)
+		}
+	}
+
+	called := 0
+	c := NewPassphraseCache(dir, func() (string, error) {
+		called++
+		return "passphrase", nil
+	})
+	for _, key := range []string{"aws.default.cache", "aws.other.cache"} {
+		value, err := c.Get(key)
+		if err != nil {
+			t.Errorf("%#v", err)
+		}
+		if value != key {
+			t.Errorf("%s is not equal %s", value, key)
+		}
+	}
+	if called != 1 {
+		t.Errorf("%d is not equal %d", called, 1)
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	if c, err := NewCache("none", "/tmp", nil); c != nil || err != nil {
+		t.Errorf("%v, %v is not nil", c, err)
+	}
+	if c, err := NewCache("passphrase", "/tmp", nil); c == nil || err != nil {
+		t.Errorf("%v, %v", c, err)
+	}
+	if _, err := NewCache("keyring", "/tmp", nil); err == nil {
+		t.Error("It need to return secret store required error.")
+	}
+	if c, err := NewCache("keyring", "/tmp", StoreMock{}); c == nil || err != nil {
+		t.Errorf("%v, %v", c, err)
+	}
+	if _, err := NewCache("unknown", "/tmp", nil); err == nil {
+		t.Error("It need to return not supported error.")
+	}
+}
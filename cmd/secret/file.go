@@ -0,0 +1,229 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileMagic   = "OLACSEC"
+	fileVersion = 1
+	saltSize    = 16
+	nonceSize   = 24
+	headerSize  = len(fileMagic) + 1 + saltSize + nonceSize
+)
+
+// File stores the secrets in a file encrypted with a key derived from the passphrase by scrypt.
+// The file is replaced atomically, and the processes updating it are serialized by the lock file.
+type File struct {
+	Path       string
+	Passphrase func() (string, error)
+	// Confirm asks the passphrase again when the file is created, it is not confirmed if Confirm is nil
+	Confirm func() (string, error)
+
+	mu   sync.Mutex
+	salt []byte
+	key  *[32]byte
+}
+
+// NewFile creates a File instance
+func NewFile(path string, passphrase func() (string, error)) *File {
+	return &File{
+		Path:       path,
+		Passphrase: passphrase,
+	}
+}
+
+// Get returns the secret
+func (f *File) Get(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secrets, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set stores the secret
+func (f *File) Set(key string, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := lockFile(f.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+	secrets[key] = value
+	return f.write(secrets)
+}
+
+// Delete removes the secret
+func (f *File) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := lockFile(f.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return nil
+	}
+	delete(secrets, key)
+	return f.write(secrets)
+}
+
+func (f *File) read() (map[string]string, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	if len(data) < headerSize || string(data[:len(fileMagic)]) != fileMagic {
+		return nil, errors.Errorf("%s is not a secret file", f.Path)
+	}
+	if data[len(fileMagic)] != fileVersion {
+		return nil, errors.Errorf("%s is unsupported version %d", f.Path, data[len(fileMagic)])
+	}
+	salt := data[len(fileMagic)+1 : len(fileMagic)+1+saltSize]
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[len(fileMagic)+1+saltSize:headerSize])
+	key, err := f.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, data[headerSize:], &nonce, key)
+	if !ok {
+		return nil, errors.Errorf("failed to decrypt %s, the passphrase may be wrong", f.Path)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (f *File) write(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	// the salt is kept from reading the file, or the file is created
+	var key *[32]byte
+	if f.salt == nil {
+		key, err = f.newKey()
+	} else {
+		key, err = f.deriveKey(f.salt)
+	}
+	if err != nil {
+		return err
+	}
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(fileMagic)
+	buf.WriteByte(fileVersion)
+	buf.Write(f.salt)
+	buf.Write(nonce[:])
+	buf.Write(secretbox.Seal(nil, plain, &nonce, key))
+	return writeFile(f.Path, buf.Bytes())
+}
+
+// writeFile replaces the file with the data through a synced temporary file in the same directory,
+// so the secrets are not lost even if the process is interrupted
+func writeFile(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// newKey generates the salt of the new file, and derives the key from the confirmed passphrase
+func (f *File) newKey() (*[32]byte, error) {
+	passphrase, err := f.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if f.Confirm != nil {
+		confirmed, err := f.Confirm()
+		if err != nil {
+			return nil, err
+		}
+		if confirmed != passphrase {
+			return nil, errors.Errorf("the passphrases do not match")
+		}
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return f.setKey(passphrase, salt)
+}
+
+// deriveKey returns the key of the salt, asking the passphrase only once
+func (f *File) deriveKey(salt []byte) (*[32]byte, error) {
+	if f.key != nil && bytes.Equal(f.salt, salt) {
+		return f.key, nil
+	}
+	passphrase, err := f.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	return f.setKey(passphrase, salt)
+}
+
+// setKey derives the key from the passphrase and the salt, and keeps them for the next time
+func (f *File) setKey(passphrase string, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	f.salt = append([]byte{}, salt...)
+	f.key = &key
+	return f.key, nil
+}
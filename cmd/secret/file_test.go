@@ -0,0 +1,148 @@
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func passphrase(value string) func() (string, error) {
+	return func() (string, error) {
+		return value, nil
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "secrets.enc")
+
+	f := NewFile(file, passphrase("passphrase"))
+	if _, err := f.Get("client-secret"); err != ErrNotFound {
+		t.Errorf("%v is not equal %v", err, ErrNotFound)
+	}
+	if err := f.Set("client-secret", "secret value"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := f.Set("cache", "cache value"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if strings.Contains(string(data), "secret value") {
+		t.Error("the secret is written in plaintext")
+	}
+
+	reopened := NewFile(file, passphrase("passphrase"))
+	value, err := reopened.Get("client-secret")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "secret value" {
+		t.Errorf("%s is not equal %s", value, "secret value")
+	}
+	if err := reopened.Delete("client-secret"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := reopened.Get("client-secret"); err != ErrNotFound {
+		t.Errorf("%v is not equal %v", err, ErrNotFound)
+	}
+	value, err = reopened.Get("cache")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "cache value" {
+		t.Errorf("%s is not equal %s", value, "cache value")
+	}
+
+	wrong := NewFile(file, passphrase("wrong"))
+	if _, err := wrong.Get("cache"); err == nil {
+		t.Error("It need to return decrypt error.")
+	}
+}
+
+func TestFileBroken(t *testing.T) {
+	dist, err := ioutil.TempFile("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.Remove(dist.Name())
+	dist.WriteString("plaintext")
+	dist.Close()
+	if _, err := NewFile(dist.Name(), passphrase("passphrase")).Get("cache"); err == nil {
+		t.Error("It need to return not a secret file error.")
+	}
+}
+
+func TestFileConfirm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "secrets.enc")
+
+	f := NewFile(file, passphrase("passphrase"))
+	f.Confirm = passphrase("typo")
+	if err := f.Set("client-secret", "secret value"); err == nil {
+		t.Error("It need to return not match error.")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("%v is not the file not created", err)
+	}
+
+	f.Confirm = passphrase("passphrase")
+	if err := f.Set("client-secret", "secret value"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	// the passphrase is confirmed only when the file is created
+	reopened := NewFile(file, passphrase("passphrase"))
+	reopened.Confirm = passphrase("typo")
+	if err := reopened.Set("cache", "cache value"); err != nil {
+		t.Errorf("%#v", err)
+	}
+}
+
+func TestFileConcurrentSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "secrets.enc")
+	if err := NewFile(file, passphrase("passphrase")).Set("client-secret", "secret value"); err != nil {
+		t.Fatalf("%#v", err)
+	}
+
+	// each File is opened like another process, and the lock file serializes the updates
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			errs <- NewFile(file, passphrase("passphrase")).Set(fmt.Sprintf("cache.%d", i), "cache value")
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("%#v", err)
+		}
+	}
+	f := NewFile(file, passphrase("passphrase"))
+	for _, key := range []string{"client-secret", "cache.0", "cache.1", "cache.2", "cache.3"} {
+		if _, err := f.Get(key); err != nil {
+			t.Errorf("%s is lost: %v", key, err)
+		}
+	}
+	files, err := filepath.Glob(path.Join(dir, "secrets.enc.tmp*"))
+	if err != nil || len(files) != 0 {
+		t.Errorf("%v, %v are left", files, err)
+	}
+}
@@ -0,0 +1,96 @@
+package secret
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// SecretService stores the secrets in the Secret Service (GNOME Keyring, KWallet) with secret-tool
+type SecretService struct {
+	Command string
+}
+
+// NewSecretService creates a SecretService instance
+func NewSecretService() *SecretService {
+	return &SecretService{Command: "secret-tool"}
+}
+
+func (s *SecretService) attributes(key string) []string {
+	return []string{"service", ServiceName, "key", key}
+}
+
+// Get looks up the secret
+func (s *SecretService) Get(key string) (string, error) {
+	stdout, stderr, err := run(s.Command, append([]string{"lookup"}, s.attributes(key)...), "")
+	if err != nil {
+		// secret-tool exits with 1 silently when the secret is not exists
+		if _, ok := err.(*exec.ExitError); ok && strings.TrimSpace(stderr) == "" {
+			return "", ErrNotFound
+		}
+		return "", commandError(s.Command, stderr, err)
+	}
+	return strings.TrimSuffix(stdout, "\n"), nil
+}
+
+// Set stores the secret
+func (s *SecretService) Set(key string, value string) error {
+	args := append([]string{"store", "--label", ServiceName + " " + key}, s.attributes(key)...)
+	if _, stderr, err := run(s.Command, args, value); err != nil {
+		return commandError(s.Command, stderr, err)
+	}
+	return nil
+}
+
+// Delete clears the secret
+func (s *SecretService) Delete(key string) error {
+	if _, stderr, err := run(s.Command, append([]string{"clear"}, s.attributes(key)...), ""); err != nil {
+		return commandError(s.Command, stderr, err)
+	}
+	return nil
+}
+
+// Pass stores the secrets in the standard unix password manager
+type Pass struct {
+	Command string
+	Prefix  string
+}
+
+// NewPass creates a Pass instance
+func NewPass() *Pass {
+	return &Pass{Command: "pass", Prefix: ServiceName}
+}
+
+func (p *Pass) name(key string) string {
+	return p.Prefix + "/" + key
+}
+
+// Get shows the secret
+func (p *Pass) Get(key string) (string, error) {
+	stdout, stderr, err := run(p.Command, []string{"show", p.name(key)}, "")
+	if err != nil {
+		if strings.Contains(stderr, "is not in the password store") {
+			return "", ErrNotFound
+		}
+		return "", commandError(p.Command, stderr, err)
+	}
+	return strings.TrimSuffix(stdout, "\n"), nil
+}
+
+// Set inserts the secret, overwriting the existing one
+func (p *Pass) Set(key string, value string) error {
+	if _, stderr, err := run(p.Command, []string{"insert", "--multiline", "--force", p.name(key)}, value); err != nil {
+		return commandError(p.Command, stderr, err)
+	}
+	return nil
+}
+
+// Delete removes the secret
+func (p *Pass) Delete(key string) error {
+	if _, stderr, err := run(p.Command, []string{"rm", "--force", p.name(key)}, ""); err != nil {
+		if strings.Contains(stderr, "is not in the password store") {
+			return nil
+		}
+		return commandError(p.Command, stderr, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+// fakePass emulates pass with files in the directory
+const fakePass = `#!/bin/sh
+store=%s
+case "$1" in
+show)
+	if [ ! -f "$store/$2" ]; then
+		echo "Error: $2 is not in the password store." >&2
+		exit 1
+	fi
+	cat "$store/$2"
+	;;
+insert)
+	mkdir -p "$(dirname "$store/$4")"
+	cat > "$store/$4"
+	;;
+rm)
+	rm "$store/$3"
+	;;
+esac
+`
+
+func TestPass(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pass is not available on windows")
+	}
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	command := path.Join(dir, "pass")
+	if err := ioutil.WriteFile(command, []byte(fmt.Sprintf(fakePass, path.Join(dir, "store"))), 0700); err != nil {
+		t.Fatalf("%#v", err)
+	}
+
+	p := NewPass()
+	p.Command = command
+	if _, err := p.Get("client-secret"); err != ErrNotFound {
+		t.Errorf("%v is not equal %v", err, ErrNotFound)
+	}
+	if err := p.Set("client-secret", "line1\nline2"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	value, err := p.Get("client-secret")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if value != "line1\nline2" {
+		t.Errorf("%s is not equal %s", value, "line1\nline2")
+	}
+	if _, err := os.Stat(path.Join(dir, "store", ServiceName, "client-secret")); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := p.Delete("client-secret"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := p.Get("client-secret"); err != ErrNotFound {
+		t.Errorf("%v is not equal %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package secret
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the file exclusively across the processes, and returns the function releasing it
+func lockFile(name string) (func(), error) {
+	fd, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+		fd.Close()
+	}, nil
+}
@@ -0,0 +1,33 @@
+package secret
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const lockfileExclusiveLock = 0x2
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile locks the file exclusively across the processes, and returns the function releasing it
+func lockFile(name string) (func(), error) {
+	fd, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(fd.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		fd.Close()
+		return nil, err
+	}
+	return func() {
+		procUnlockFileEx.Call(fd.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+		fd.Close()
+	}, nil
+}
@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ServiceName is the name the secrets are stored under in the keyrings
+const ServiceName = "onelogin-aws-connector"
+
+// PassphraseEnv is the environment variable of the passphrase of the encrypted file
+const PassphraseEnv = "ONELOGIN_AWS_CONNECTOR_PASSPHRASE"
+
+// ErrNotFound is returned when the secret is not stored
+var ErrNotFound = errors.New("secret is not exists")
+
+// Store saves secrets instead of the plaintext files
+type Store interface {
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	Delete(key string) error
+}
+
+// Kinds are the names of the supported stores
+var Kinds = []string{"none", "secret-service", "pass", "file"}
+
+// New creates the Store of the kind, or nil for "none" to keep the plaintext files.
+// The encrypted file is created in dir.
+func New(kind string, dir string) (Store, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "secret-service":
+		return NewSecretService(), nil
+	case "pass":
+		return NewPass(), nil
+	case "file":
+		f := NewFile(path.Join(dir, "secrets.enc"), terminalPassphrase)
+		f.Confirm = func() (string, error) {
+			return askPassphrase("Confirm your secret file passphrase: ")
+		}
+		return f, nil
+	}
+	return nil, errors.Errorf("%s is not supported secret store", kind)
+}
+
+// terminalPassphrase reads the passphrase from PassphraseEnv, or asks it on the terminal
+func terminalPassphrase() (string, error) {
+	return askPassphrase("Enter your secret file passphrase: ")
+}
+
+// cachePassphrase reads the passphrase of the encrypted cache files from PassphraseEnv, or asks it on the terminal
+func cachePassphrase() (string, error) {
+	return askPassphrase("Enter your cache passphrase: ")
+}
+
+// askPassphrase reads the passphrase from PassphraseEnv, or asks it on the terminal with the message
+func askPassphrase(message string) (string, error) {
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return passphrase, nil
+	}
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return "", errors.Errorf("%s is required to read the passphrase without a terminal", PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, message)
+	tmp, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(os.Stderr, "")
+	if err != nil {
+		return "", err
+	}
+	return string(tmp), nil
+}
+
+// run executes the command with the input, and returns the standard output and error
+func run(name string, args []string, input string) (string, string, error) {
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// commandError wraps the error of the command with its standard error
+func commandError(name string, stderr string, err error) error {
+	if message := strings.TrimSpace(stderr); message != "" {
+		return errors.Errorf("%s failed: %s", name, message)
+	}
+	return errors.Wrapf(err, "%s failed", name)
+}
@@ -0,0 +1,33 @@
+package secret
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		kind    string
+		want    string
+		wantErr bool
+	}{
+		{kind: "", want: "<nil>"},
+		{kind: "none", want: "<nil>"},
+		{kind: "secret-service", want: "*secret.SecretService"},
+		{kind: "pass", want: "*secret.Pass"},
+		{kind: "file", want: "*secret.File"},
+		{kind: "unknown", want: "<nil>", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			got, err := New(tt.kind, "/tmp")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if actual := fmt.Sprintf("%T", got); actual != tt.want {
+				t.Errorf("%s is not equal %s", actual, tt.want)
+			}
+		})
+	}
+}
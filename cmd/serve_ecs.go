@@ -0,0 +1,87 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/daemon"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/metadata"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+)
+
+var ecsListenAddress string
+var authorizationToken string
+
+// serveECSCmd represents the serve-ecs command
+var serveECSCmd = &cobra.Command{
+	Use:   "serve-ecs",
+	Short: "Serve AWS Credentials as ECS container credentials endpoint",
+	Long: `Serve-ecs runs a local ECS container credentials endpoint serving AWS
+credentials of the profiles on http://<listen>/<profile>. The credentials are
+refreshed before they expire, and the profiles requested at once are logged in
+on the terminal one by one.
+
+Point the AWS SDKs to the server with
+AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:8170/<profile>
+AWS_CONTAINER_AUTHORIZATION_TOKEN=<authorization token>`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		promptOutput = os.Stderr
+		targets, err := daemonProfiles(configFile, profiles)
+		if err != nil {
+			errorExit(err)
+		}
+		if authorizationToken == "" {
+			authorizationToken, err = generateAuthorizationToken()
+			if err != nil {
+				errorExit(err)
+			}
+		}
+		provider, err := newCredentialsProvider(targets)
+		if err != nil {
+			errorExit(err)
+		}
+		server := metadata.NewECS(provider, targets, authorizationToken)
+		logging.Info("container credentials endpoint is listening", logging.F("address", ecsListenAddress))
+		fmt.Fprintf(os.Stderr, "AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/%s\n", ecsListenAddress, targets[0])
+		fmt.Fprintf(os.Stderr, "AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", authorizationToken)
+		if err := http.ListenAndServe(ecsListenAddress, server); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serveECSCmd)
+	serveECSCmd.Flags().StringVarP(&ecsListenAddress, "listen", "", "127.0.0.1:8170", "Address to listen on")
+	serveECSCmd.Flags().StringSliceVarP(&profiles, "profiles", "", nil, "Comma separated aws profile names to serve (default all profiles)")
+	serveECSCmd.Flags().StringVarP(&authorizationToken, "authorization-token", "", os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"), "Authorization token required to clients (default random token)")
+	serveECSCmd.Flags().DurationVarP(&refreshBefore, "refresh-before", "", daemon.DefaultRefreshBefore, "Refresh AWS credentials this long before they expire")
+}
+
+func generateAuthorizationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/daemon"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/metadata"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+)
+
+var listenAddress string
+var roleName string
+var requireToken bool
+
+// serveIMDSCmd represents the serve-imds command
+var serveIMDSCmd = &cobra.Command{
+	Use:   "serve-imds",
+	Short: "Serve AWS Credentials as EC2 instance metadata service",
+	Long: `Serve-imds runs a local EC2 instance metadata service serving AWS credentials
+of the profile as the instance profile credentials. The credentials are
+refreshed before they expire.
+
+Point the AWS SDKs to the server with
+AWS_EC2_METADATA_SERVICE_ENDPOINT=http://127.0.0.1:8169/
+
+Do not listen on a public address, the server has no authentication.`,
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		if awsProfile == "" {
+			awsProfile = "default"
+		}
+		promptOutput = os.Stderr
+		if _, _, err := fetchConfig(configFile, awsProfile); err != nil {
+			errorExit(err)
+		}
+		provider, err := newCredentialsProvider([]string{awsProfile})
+		if err != nil {
+			errorExit(err)
+		}
+		server := metadata.NewIMDS(provider, awsProfile)
+		if roleName != "" {
+			server.RoleName = roleName
+		}
+		server.Region = region
+		server.RequireToken = requireToken
+		logging.Info("instance metadata service is listening", logging.F("address", listenAddress))
+		if err := http.ListenAndServe(listenAddress, server); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serveIMDSCmd)
+	serveIMDSCmd.Flags().StringVarP(&listenAddress, "listen", "", "127.0.0.1:8169", "Address to listen on")
+	serveIMDSCmd.Flags().StringVarP(&roleName, "role-name", "", "", "Instance profile role name (default aws profile name)")
+	serveIMDSCmd.Flags().BoolVarP(&requireToken, "imds-v2-only", "", false, "Reject requests without IMDSv2 session token")
+	serveIMDSCmd.Flags().DurationVarP(&refreshBefore, "refresh-before", "", daemon.DefaultRefreshBefore, "Refresh AWS credentials this long before they expire")
+	serveIMDSCmd.Flags().StringVarP(&region, "aws-region", "", "", "AWS Region")
+	serveIMDSCmd.Flags().StringVarP(&awsProfile, "aws-profile", "", awsProfile, "aws profile name")
+}
+
+// newCredentialsProvider creates a provider refreshing credentials of the profiles
+// before they expire, asking the daemon first and logging in on the terminal otherwise.
+// The logins on the terminal run one at a time, even if the profiles are requested at once.
+func newCredentialsProvider(targets []string) (metadata.Provider, error) {
+	if err := checkRefreshBefore(configFile, targets, refreshBefore); err != nil {
+		return nil, err
+	}
+	d := daemon.New(targets, loadCache, func(ctx context.Context, profile string) (*sts.Credentials, error) {
+		creds, ok, err := askDaemon(profile)
+		if err != nil || ok {
+			return creds, err
+		}
+		creds, err = authenticateOnTerminal(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveCache(profile, creds); err != nil {
+			return nil, err
+		}
+		return creds, nil
+	})
+	d.RefreshBefore = refreshBefore
+	d.LoginTimeout = loginTimeout
+	if err := d.Validate(); err != nil {
+		return nil, failure.Wrap(failure.Usage, err)
+	}
+	return d, nil
+}
+
+// terminalLogin serializes the logins on the terminal, so the prompts of the profiles requested at once never interleave
+var terminalLogin sync.Mutex
+
+// authenticateOnTerminal logs in to the profile after the other logins on the terminal
+func authenticateOnTerminal(ctx context.Context, profile string) (*sts.Credentials, error) {
+	terminalLogin.Lock()
+	defer terminalLogin.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return authenticateWithContext(ctx, profile, newInteractiveEvent())
+}
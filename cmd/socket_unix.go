@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket listens on the unix socket created with 0600, so other users can never connect to it
+func listenSocket(socket string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", socket)
+}
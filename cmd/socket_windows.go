@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"net"
+	"os"
+)
+
+// listenSocket listens on the unix socket readable only by the user
+func listenSocket(socket string) (net.Listener, error) {
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,242 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/config"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/failure"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/login"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/credentials"
+)
+
+var callerIdentity bool
+
+// callerIdentitySTS creates the STS client confirming the identity of the credentials
+var callerIdentitySTS = login.NewCredentialsSTS
+
+// statusResult is the state of the profiles printed by status
+type statusResult struct {
+	Profiles []profileStatus `json:"profiles"`
+}
+
+type profileStatus struct {
+	Profile string `json:"profile"`
+	Service string `json:"service"`
+	RoleArn string `json:"role_arn"`
+	AWS     struct {
+		Cached     bool       `json:"cached"`
+		Valid      bool       `json:"valid"`
+		Expiration *time.Time `json:"expiration,omitempty"`
+	} `json:"aws"`
+	// OneLogin is the token cache of the service, which is nil if the service is not exists
+	OneLogin *oneloginStatus `json:"onelogin,omitempty"`
+	// Identity is the result of sts:GetCallerIdentity with --caller-identity
+	Identity *identityStatus `json:"identity,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type oneloginStatus struct {
+	Cached           bool       `json:"cached"`
+	AccessValid      bool       `json:"access_valid"`
+	AccessExpiresAt  *time.Time `json:"access_expires_at,omitempty"`
+	RefreshValid     bool       `json:"refresh_valid"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+}
+
+type identityStatus struct {
+	Account string `json:"account,omitempty"`
+	Arn     string `json:"arn,omitempty"`
+	UserID  string `json:"user_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:     "status [PROFILE...]",
+	Aliases: []string{"whoami"},
+	Short:   "Show the cached credentials of the profiles",
+	Long: `Status lists every profile in config.toml, or the profiles of the arguments,
+with the expiration of the cached AWS credentials and the cached OneLogin tokens of the service.
+It never logs in, and the caches are only read, so they are neither migrated nor removed.
+The passphrase of the file secret store or the passphrase cache encryption is asked only to read the caches.
+
+With --caller-identity, the valid AWS credentials are confirmed by sts:GetCallerIdentity.`,
+	PreRun: openStoresReadOnly,
+	Run: func(cmd *cobra.Command, args []string) {
+		onelogin.CacheDir = cacheDir
+		result, err := profileStatuses(configFile, args, time.Now())
+		if err != nil {
+			errorExit(err)
+		}
+		printResult(result, func(w io.Writer) error {
+			return writeStatus(w, result, time.Now())
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVarP(&callerIdentity, "caller-identity", "", false, "Confirm the identity of the valid AWS credentials with sts:GetCallerIdentity")
+}
+
+// profileStatuses returns the state of the profiles, or all profiles in the config file if names is empty
+func profileStatuses(file string, names []string, now time.Time) (*statusResult, error) {
+	c, err := config.Load(file)
+	if err != nil {
+		return nil, failure.Wrap(failure.Config, err)
+	}
+	if len(names) == 0 {
+		for name := range c.App {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	result := &statusResult{Profiles: []profileStatus{}}
+	for _, name := range names {
+		app, ok := c.App[name]
+		if !ok {
+			return nil, failure.Errorf(failure.Config, "%s profile is not exists", name)
+		}
+		s := profileStatus{
+			Profile: name,
+			Service: app.ServiceName(),
+			RoleArn: app.RoleArn,
+		}
+		service, ok := c.Service[app.ServiceName()]
+		if ok {
+			s.OneLogin = tokenStatus(onelogin.CachedCredentials(service.ClientToken), now)
+		}
+		creds, err := readCache(name)
+		if err != nil {
+			s.Error = err.Error()
+		} else if creds != nil {
+			s.AWS.Cached = true
+			s.AWS.Expiration = creds.Expiration
+			s.AWS.Valid = creds.Expiration != nil && now.Before(*creds.Expiration)
+		}
+		if callerIdentity && s.AWS.Valid {
+			endpoint := ""
+			if service != nil {
+				endpoint = service.STSEndpoint
+			}
+			s.Identity = identity(creds, endpoint)
+		}
+		result.Profiles = append(result.Profiles, s)
+	}
+	return result, nil
+}
+
+// tokenStatus returns the state of the OneLogin token cache
+func tokenStatus(v *credentials.Value, now time.Time) *oneloginStatus {
+	s := &oneloginStatus{}
+	if v == nil {
+		return s
+	}
+	s.Cached = true
+	s.AccessExpiresAt = &v.AccessExpiresAt
+	s.AccessValid = now.Before(v.AccessExpiresAt)
+	s.RefreshExpiresAt = &v.RefreshExpiresAt
+	s.RefreshValid = now.Before(v.RefreshExpiresAt)
+	return s
+}
+
+// identity calls sts:GetCallerIdentity with the credentials in --request-timeout, and the error is kept in the status
+func identity(creds *sts.Credentials, endpoint string) *identityStatus {
+	client, err := callerIdentitySTS(creds, endpoint)
+	if err != nil {
+		return &identityStatus{Error: err.Error()}
+	}
+	ctx, cancel := context.Background(), func() {}
+	if requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+	}
+	defer cancel()
+	output, err := client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return &identityStatus{Error: err.Error()}
+	}
+	s := &identityStatus{}
+	if output.Account != nil {
+		s.Account = *output.Account
+	}
+	if output.Arn != nil {
+		s.Arn = *output.Arn
+	}
+	if output.UserId != nil {
+		s.UserID = *output.UserId
+	}
+	return s
+}
+
+// writeStatus writes the state of the profiles as the table
+func writeStatus(out io.Writer, result *statusResult, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	header := []string{"PROFILE", "SERVICE", "AWS CREDENTIALS", "ONELOGIN ACCESS TOKEN", "ONELOGIN REFRESH TOKEN"}
+	if callerIdentity {
+		header = append(header, "IDENTITY")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, s := range result.Profiles {
+		aws := expiry(s.AWS.Cached, s.AWS.Expiration, now)
+		if s.Error != "" {
+			aws = "error: " + s.Error
+		}
+		access, refresh := "unknown service", "unknown service"
+		if s.OneLogin != nil {
+			access = expiry(s.OneLogin.Cached, s.OneLogin.AccessExpiresAt, now)
+			refresh = expiry(s.OneLogin.Cached, s.OneLogin.RefreshExpiresAt, now)
+		}
+		row := []string{s.Profile, s.Service, aws, access, refresh}
+		if callerIdentity {
+			switch {
+			case s.Identity == nil:
+				row = append(row, "-")
+			case s.Identity.Error != "":
+				row = append(row, "error: "+strings.Join(strings.Fields(s.Identity.Error), " "))
+			default:
+				row = append(row, s.Identity.Arn)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// expiry describes the expiration of the cache
+func expiry(cached bool, expiration *time.Time, now time.Time) string {
+	if !cached {
+		return "not cached"
+	}
+	if expiration == nil {
+		return "expired"
+	}
+	at := expiration.Local().Format("2006-01-02 15:04:05")
+	if now.Before(*expiration) {
+		return "valid until " + at
+	}
+	return "expired at " + at
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+)
+
+type callerIdentitySTSMock struct {
+	stsiface.STSAPI
+	AccessKeyID string
+}
+
+func (s *callerIdentitySTSMock) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, fmt.Errorf("sts:GetCallerIdentity is called without the timeout")
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+		Arn:     aws.String("arn:aws:sts::123456789012:assumed-role/Admin/" + s.AccessKeyID),
+		UserId:  aws.String("AROA:" + s.AccessKeyID),
+	}, nil
+}
+
+func TestStatusCmdProfileStatuses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onelogin-aws-connector")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir = dir
+	caches = nil
+	onelogin.CacheDir = dir
+	onelogin.Store = nil
+	callerIdentity = true
+	original := callerIdentitySTS
+	defer func() {
+		callerIdentity = false
+		callerIdentitySTS = original
+	}()
+	callerIdentitySTS = func(creds *sts.Credentials, endpoint string) (stsiface.STSAPI, error) {
+		return &callerIdentitySTSMock{AccessKeyID: *creds.AccessKeyId}, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	valid := now.Add(time.Hour)
+	expired := now.Add(-time.Hour)
+	for profile, expiration := range map[string]time.Time{"default": valid, "sandbox": expired} {
+		if err := saveCache(profile, &sts.Credentials{
+			AccessKeyId:     aws.String(profile + "-access-key-id"),
+			SecretAccessKey: aws.String("secret-access-key"),
+			SessionToken:    aws.String("session-token"),
+			Expiration:      aws.Time(expiration),
+		}); err != nil {
+			t.Fatalf("%#v", err)
+		}
+	}
+	token := fmt.Sprintf("AccessToken = \"access-token\"\nRefreshToken = \"refresh-token\"\nCreatedAt = %s\nAccessExpiresAt = %s\nRefreshExpiresAt = %s\n",
+		now.Format(time.RFC3339), expired.Format(time.RFC3339), valid.Format(time.RFC3339))
+	if err := ioutil.WriteFile(path.Join(dir, "onelogin.client-token.cache"), []byte(token), 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+
+	result, err := profileStatuses("fixtures/multiservice.toml", nil, now)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if len(result.Profiles) != 3 {
+		t.Fatalf("%d is not equal 3", len(result.Profiles))
+	}
+	def, missing, sandbox := result.Profiles[0], result.Profiles[1], result.Profiles[2]
+	if def.Profile != "default" || missing.Profile != "missing" || sandbox.Profile != "sandbox" {
+		t.Errorf("%s, %s and %s are not sorted", def.Profile, missing.Profile, sandbox.Profile)
+	}
+	if !def.AWS.Cached || !def.AWS.Valid || !def.AWS.Expiration.Equal(valid) {
+		t.Errorf("%#v is not valid until %v", def.AWS, valid)
+	}
+	if def.OneLogin == nil || def.OneLogin.AccessValid || !def.OneLogin.RefreshValid || !def.OneLogin.RefreshExpiresAt.Equal(valid) {
+		t.Errorf("%#v is not the access token expired and the refresh token valid", def.OneLogin)
+	}
+	if def.Identity == nil || def.Identity.Arn != "arn:aws:sts::123456789012:assumed-role/Admin/default-access-key-id" {
+		t.Errorf("%#v is not the identity of the default profile", def.Identity)
+	}
+	if missing.AWS.Cached || missing.OneLogin != nil || missing.Identity != nil {
+		t.Errorf("%#v is not the profile without the caches and the service", missing)
+	}
+	if !sandbox.AWS.Cached || sandbox.AWS.Valid || sandbox.Identity != nil {
+		t.Errorf("%#v is not expired", sandbox.AWS)
+	}
+	if sandbox.OneLogin == nil || sandbox.OneLogin.Cached {
+		t.Errorf("%#v is cached", sandbox.OneLogin)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStatus(&buf, result, now); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "PROFILE") {
+		t.Fatalf("%s is not the table of 3 profiles", buf.String())
+	}
+	for i, want := range []string{"valid until " + valid.Local().Format("2006-01-02 15:04:05"), "unknown service", "expired at " + expired.Local().Format("2006-01-02 15:04:05")} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("%s does not contain %s", lines[i+1], want)
+		}
+	}
+
+	if _, err := profileStatuses("fixtures/multiservice.toml", []string{"none"}, now); err == nil {
+		t.Error("It need to return profile not exists error.")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright © 2017 LIFULL Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/password"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+)
+
+// totpRegistry keeps the TOTP keys in the secret store, or nil without the secret store
+var totpRegistry *totp.Registry
+
+var totpAlgorithm string
+var totpDigits int
+var totpPeriod time.Duration
+var totpSecretSource string
+
+// totpCmd represents the totp command
+var totpCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Manage TOTP keys of MFA devices",
+	Long: `Totp manages the TOTP keys answering the MFA token of the MFA devices.
+The keys are stored in the secret store, and the MFA token of the device type
+is generated without asking it on the terminal.`,
+}
+
+// totpAddCmd represents the totp add command
+var totpAddCmd = &cobra.Command{
+	Use:   "add DEVICE_TYPE",
+	Short: "Register TOTP key of the MFA device type",
+	Long: `Add registers the TOTP key of the MFA device type such as "Google Authenticator".
+The base32 secret or the otpauth URI is read from the terminal or --secret-source.`,
+	Args:   cobra.ExactArgs(1),
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := requireTOTPRegistry()
+		if err != nil {
+			errorExit(err)
+		}
+		value, err := readTOTPSecret()
+		if err != nil {
+			errorExit(err)
+		}
+		key, err := totpKey(value, totpAlgorithm, totpDigits, totpPeriod)
+		if err != nil {
+			errorExit(err)
+		}
+		if err := registry.Add(args[0], key); err != nil {
+			errorExit(err)
+		}
+		code, err := key.Code(time.Now())
+		if err != nil {
+			errorExit(err)
+		}
+		printResult(map[string]string{"type": args[0], "code": code}, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "%s is registered, the current code is %s\n", args[0], code)
+			return err
+		})
+	},
+}
+
+// totpListCmd represents the totp list command
+var totpListCmd = &cobra.Command{
+	Use:    "list",
+	Short:  "List registered MFA device types",
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := requireTOTPRegistry()
+		if err != nil {
+			errorExit(err)
+		}
+		types, err := registry.List()
+		if err != nil {
+			errorExit(err)
+		}
+		items := []totpListItem{}
+		for _, t := range types {
+			key, err := registry.Get(t)
+			if err != nil {
+				errorExit(err)
+			}
+			items = append(items, totpListItem{Type: t, Algorithm: key.Algorithm, Digits: key.Digits, Period: key.Period.String()})
+		}
+		printResult(items, func(w io.Writer) error {
+			for _, item := range items {
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%d digits\t%s\n", item.Type, item.Algorithm, item.Digits, item.Period); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	},
+}
+
+// totpListItem is the registered TOTP key printed with --output json or yaml
+type totpListItem struct {
+	Type      string `json:"type"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    string `json:"period"`
+}
+
+// totpRemoveCmd represents the totp remove command
+var totpRemoveCmd = &cobra.Command{
+	Use:    "remove DEVICE_TYPE",
+	Short:  "Remove TOTP key of the MFA device type",
+	Args:   cobra.ExactArgs(1),
+	PreRun: openStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := requireTOTPRegistry()
+		if err != nil {
+			errorExit(err)
+		}
+		if err := registry.Remove(args[0]); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(totpCmd)
+	totpCmd.AddCommand(totpAddCmd)
+	totpCmd.AddCommand(totpListCmd)
+	totpCmd.AddCommand(totpRemoveCmd)
+	totpAddCmd.Flags().StringVarP(&totpAlgorithm, "algorithm", "", totp.Algorithm, "HMAC algorithm (SHA1, SHA256 or SHA512)")
+	totpAddCmd.Flags().IntVarP(&totpDigits, "digits", "", totp.Digits, "Length of the codes")
+	totpAddCmd.Flags().DurationVarP(&totpPeriod, "period", "", totp.Period, "Time step of the codes")
+	totpAddCmd.Flags().StringVarP(&totpSecretSource, "secret-source", "", "", "Source of the secret instead of the terminal, see --password-source")
+}
+
+func requireTOTPRegistry() (*totp.Registry, error) {
+	if totpRegistry == nil {
+		return nil, errors.Errorf("TOTP keys need a secret store. Please run `onelogin-aws-connector init --secret-store %s`", strings.Join(secret.Kinds[1:], "|"))
+	}
+	return totpRegistry, nil
+}
+
+func readTOTPSecret() (string, error) {
+	if totpSecretSource != "" {
+		source, err := password.Parse(totpSecretSource)
+		if err != nil {
+			return "", err
+		}
+		return source.Password()
+	}
+	fmt.Fprint(os.Stderr, "Enter your TOTP secret or otpauth URI: ")
+	tmp, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(os.Stderr, "")
+	if err != nil {
+		return "", err
+	}
+	return string(tmp), nil
+}
+
+// totpKey creates the key of the otpauth URI, or the base32 secret with the parameters
+func totpKey(value string, algorithm string, digits int, period time.Duration) (*totp.Key, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "otpauth://") {
+		return totp.Parse(value)
+	}
+	key := &totp.Key{
+		Secret:    strings.TrimSpace(value),
+		Algorithm: strings.ToUpper(algorithm),
+		Digits:    digits,
+		Period:    period,
+	}
+	return key, key.Validate()
+}
+
+// registeredDeviceIndex returns the first MFA device whose TOTP key is registered
+func registeredDeviceIndex(registry *totp.Registry, devices []samlassertion.GenerateResponseFactorDevice) (int, bool) {
+	if registry == nil {
+		return 0, false
+	}
+	for i, device := range devices {
+		if !device.RequireOTPToken {
+			continue
+		}
+		if _, err := registry.Get(device.DeviceType); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// registeredToken returns the current code of the MFA device if its TOTP key is registered
+func registeredToken(registry *totp.Registry, device samlassertion.GenerateResponseFactorDevice) (string, bool, error) {
+	if registry == nil {
+		return "", false, nil
+	}
+	key, err := registry.Get(device.DeviceType)
+	if err != nil {
+		if err == secret.ErrNotFound {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	code, err := key.Code(time.Now())
+	if err != nil {
+		return "", false, err
+	}
+	logging.Debug("MFA token is generated", logging.F("DeviceType", device.DeviceType))
+	return code, true, nil
+}
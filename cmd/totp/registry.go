@@ -0,0 +1,104 @@
+package totp
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+)
+
+// indexKey is the key of the registered device types in the secret store
+const indexKey = "totp.index"
+
+// Registry keeps the keys of the MFA device types in the secret store
+type Registry struct {
+	Store secret.Store
+}
+
+// NewRegistry creates a Registry instance
+func NewRegistry(store secret.Store) *Registry {
+	return &Registry{
+		Store: store,
+	}
+}
+
+func seedKey(deviceType string) string {
+	return "totp." + deviceType
+}
+
+// Add registers the key of the device type, replacing the existing one
+func (r *Registry) Add(deviceType string, key *Key) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	if err := r.Store.Set(seedKey(deviceType), key.URI(deviceType)); err != nil {
+		return err
+	}
+	types, err := r.List()
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		if t == deviceType {
+			return nil
+		}
+	}
+	return r.save(append(types, deviceType))
+}
+
+// Get returns the key of the device type, or secret.ErrNotFound if it is not registered
+func (r *Registry) Get(deviceType string) (*Key, error) {
+	uri, err := r.Store.Get(seedKey(deviceType))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(uri)
+}
+
+// Remove unregisters the key of the device type
+func (r *Registry) Remove(deviceType string) error {
+	types, err := r.List()
+	if err != nil {
+		return err
+	}
+	rest := []string{}
+	for _, t := range types {
+		if t != deviceType {
+			rest = append(rest, t)
+		}
+	}
+	if len(rest) == len(types) {
+		return errors.Errorf("%s is not registered", deviceType)
+	}
+	if err := r.Store.Delete(seedKey(deviceType)); err != nil {
+		return err
+	}
+	return r.save(rest)
+}
+
+// List returns the registered device types
+func (r *Registry) List() ([]string, error) {
+	data, err := r.Store.Get(indexKey)
+	if err != nil {
+		if err == secret.ErrNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	types := []string{}
+	if err := json.Unmarshal([]byte(data), &types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+func (r *Registry) save(types []string) error {
+	sort.Strings(types)
+	data, err := json.Marshal(types)
+	if err != nil {
+		return err
+	}
+	return r.Store.Set(indexKey, string(data))
+}
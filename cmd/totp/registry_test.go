@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+)
+
+type StoreMock map[string]string
+
+func (s StoreMock) Get(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", secret.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s StoreMock) Set(key string, value string) error {
+	s[key] = value
+	return nil
+}
+
+func (s StoreMock) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(StoreMock{})
+	k, err := NewKey("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if err := r.Add("Google Authenticator", k); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := r.Add("OneLogin Protect", k); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if err := r.Add("Google Authenticator", k); err != nil {
+		t.Errorf("%#v", err)
+	}
+	types, err := r.List()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if fmt.Sprint(types) != "[Google Authenticator OneLogin Protect]" {
+		t.Errorf("%v is not equal %s", types, "[Google Authenticator OneLogin Protect]")
+	}
+	got, err := r.Get("Google Authenticator")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if *got != *k {
+		t.Errorf("%#v is not equal %#v", got, k)
+	}
+	if err := r.Remove("Google Authenticator"); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, err := r.Get("Google Authenticator"); err != secret.ErrNotFound {
+		t.Errorf("%v is not equal %v", err, secret.ErrNotFound)
+	}
+	if err := r.Remove("Google Authenticator"); err == nil {
+		t.Error("It need to return not registered error.")
+	}
+	types, err = r.List()
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if fmt.Sprint(types) != "[OneLogin Protect]" {
+		t.Errorf("%v is not equal %s", types, "[OneLogin Protect]")
+	}
+}
@@ -0,0 +1,174 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Period is the default time step of the codes
+const Period = 30 * time.Second
+
+// Digits is the default length of the codes
+const Digits = 6
+
+// Algorithm is the default HMAC algorithm
+const Algorithm = "SHA1"
+
+// Key is the secret and the parameters of RFC 6238
+type Key struct {
+	Secret    string
+	Algorithm string
+	Digits    int
+	Period    time.Duration
+}
+
+// NewKey creates a Key of the base32 encoded secret with the default parameters
+func NewKey(secret string) (*Key, error) {
+	k := &Key{
+		Secret:    secret,
+		Algorithm: Algorithm,
+		Digits:    Digits,
+		Period:    Period,
+	}
+	return k, k.Validate()
+}
+
+// Parse creates a Key from the otpauth URI or the base32 encoded secret
+func Parse(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "otpauth://") {
+		return NewKey(value)
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "totp" {
+		return nil, errors.Errorf("%s is not supported otpauth type", u.Host)
+	}
+	query := u.Query()
+	k := &Key{
+		Secret:    query.Get("secret"),
+		Algorithm: Algorithm,
+		Digits:    Digits,
+		Period:    Period,
+	}
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		k.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if k.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, errors.Errorf("%s is not valid digits", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		seconds, err := strconv.Atoi(period)
+		if err != nil {
+			return nil, errors.Errorf("%s is not valid period", period)
+		}
+		k.Period = time.Duration(seconds) * time.Second
+	}
+	return k, k.Validate()
+}
+
+// Validate returns an error if the Key can not generate codes
+func (k *Key) Validate() error {
+	if _, err := DecodeSecret(k.Secret); err != nil {
+		return err
+	}
+	if _, err := k.hash(); err != nil {
+		return err
+	}
+	if k.Digits < 6 || k.Digits > 8 {
+		return errors.Errorf("%d is not valid digits, it needs to be 6 to 8", k.Digits)
+	}
+	if k.Period < time.Second {
+		return errors.Errorf("%v is not valid period", k.Period)
+	}
+	return nil
+}
+
+// URI returns the otpauth URI of the Key labeled with the name
+func (k *Key) URI(name string) string {
+	query := url.Values{}
+	query.Set("secret", k.Secret)
+	query.Set("algorithm", k.Algorithm)
+	query.Set("digits", strconv.Itoa(k.Digits))
+	query.Set("period", strconv.Itoa(int(k.Period/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + name,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Code returns the code at the time
+func (k *Key) Code(t time.Time) (string, error) {
+	key, err := DecodeSecret(k.Secret)
+	if err != nil {
+		return "", err
+	}
+	h, err := k.hash()
+	if err != nil {
+		return "", err
+	}
+	counter := uint64(t.Unix() / int64(k.Period/time.Second))
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(h, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, value%modulo), nil
+}
+
+func (k *Key) hash() (func() hash.Hash, error) {
+	switch k.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, errors.Errorf("%s is not supported algorithm", k.Algorithm)
+}
+
+// Code returns the code of the otpauth URI or the base32 encoded secret at the time
+func Code(secret string, t time.Time) (string, error) {
+	k, err := Parse(secret)
+	if err != nil {
+		return "", err
+	}
+	return k.Code(t)
+}
+
+// DecodeSecret decodes the base32 secret ignoring spaces, case and padding
+func DecodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, errors.Errorf("TOTP secret is not valid base32")
+	}
+	return key, nil
+}
@@ -0,0 +1,125 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// the test vectors of RFC 6238 truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		time int64
+		want string
+	}{
+		{time: 59, want: "287082"},
+		{time: 1111111109, want: "081804"},
+		{time: 1111111111, want: "050471"},
+		{time: 1234567890, want: "005924"},
+		{time: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, time.Unix(tt.time, 0))
+		if err != nil {
+			t.Errorf("%#v", err)
+		}
+		if got != tt.want {
+			t.Errorf("%s is not equal %s", got, tt.want)
+		}
+	}
+}
+
+func TestKey_Code(t *testing.T) {
+	// the test vectors of RFC 6238 with the seeds of each algorithm
+	tests := []struct {
+		name string
+		uri  string
+		time int64
+		want string
+	}{
+		{
+			name: "SHA1",
+			uri:  "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			time: 1111111109,
+			want: "07081804",
+		},
+		{
+			name: "SHA256",
+			uri:  "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA&algorithm=SHA256&digits=8",
+			time: 1111111109,
+			want: "68084774",
+		},
+		{
+			name: "SHA512",
+			uri:  "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA&algorithm=SHA512&digits=8",
+			time: 1111111109,
+			want: "25091201",
+		},
+		{
+			name: "period",
+			uri:  "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=60",
+			time: 2222222218,
+			want: "081804",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := Parse(tt.uri)
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			got, err := k.Code(time.Unix(tt.time, 0))
+			if err != nil {
+				t.Errorf("%#v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%s is not equal %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	k, err := Parse("otpauth://totp/Google%20Authenticator?secret=GEZDGNBVGY3TQOJQ&algorithm=sha256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if k.Algorithm != "SHA256" || k.Digits != 8 || k.Period != time.Minute {
+		t.Errorf("%#v is not parsed", k)
+	}
+	again, err := Parse(k.URI("Google Authenticator"))
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if *again != *k {
+		t.Errorf("%#v is not equal %#v", again, k)
+	}
+	invalids := []string{
+		"otpauth://hotp/test?secret=GEZDGNBVGY3TQOJQ",
+		"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQ&algorithm=MD5",
+		"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQ&digits=4",
+		"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQ&period=zero",
+		"otpauth://totp/test",
+	}
+	for _, invalid := range invalids {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("%s needs to return invalid error", invalid)
+		}
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	key, err := DecodeSecret("gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if string(key) != "1234567890" {
+		t.Errorf("%s is not equal %s", string(key), "1234567890")
+	}
+	if _, err := DecodeSecret("not base32!"); err == nil {
+		t.Error("It need to return invalid secret error.")
+	}
+	if _, err := DecodeSecret(""); err == nil {
+		t.Error("It need to return invalid secret error.")
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/secret"
+	"github.com/lifull-dev/onelogin-aws-connector/cmd/totp"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+)
+
+type StoreMock map[string]string
+
+func (s StoreMock) Get(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", secret.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s StoreMock) Set(key string, value string) error {
+	s[key] = value
+	return nil
+}
+
+func (s StoreMock) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestTOTPCmdTOTPKey(t *testing.T) {
+	key, err := totpKey(" gezdgnbvgy3tqojq ", "sha256", 8, time.Minute)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if key.Secret != "gezdgnbvgy3tqojq" || key.Algorithm != "SHA256" || key.Digits != 8 || key.Period != time.Minute {
+		t.Errorf("%#v is not created with the parameters", key)
+	}
+	key, err = totpKey("otpauth://totp/test?secret=GEZDGNBVGY3TQOJQ&digits=7", "SHA1", 6, time.Minute)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if key.Digits != 7 || key.Period != totp.Period {
+		t.Errorf("%#v is not created with the otpauth URI", key)
+	}
+	if _, err := totpKey("GEZDGNBVGY3TQOJQ", "MD5", 6, time.Minute); err == nil {
+		t.Error("It need to return not supported algorithm error.")
+	}
+}
+
+func TestTOTPCmdRegisteredToken(t *testing.T) {
+	registry := totp.NewRegistry(StoreMock{})
+	key, err := totp.NewKey("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if err := registry.Add("Google Authenticator", key); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	devices := []samlassertion.GenerateResponseFactorDevice{
+		{DeviceID: 1, DeviceType: "OneLogin SMS", RequireOTPToken: true},
+		{DeviceID: 2, DeviceType: samlassertion.NotifyDeviceType, RequireOTPToken: false},
+		{DeviceID: 3, DeviceType: "Google Authenticator", RequireOTPToken: true},
+	}
+
+	event := &NotifyEvent{Registry: registry}
+	selected, err := event.ChooseDeviceIndex(devices)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if selected != 2 {
+		t.Errorf("%d is not equal %d", selected, 2)
+	}
+	token, err := event.InputMFAToken(devices[2])
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	expected, _ := key.Code(time.Now())
+	if token != expected {
+		t.Errorf("%s is not equal %s", token, expected)
+	}
+	if _, err := event.InputMFAToken(devices[0]); err == nil {
+		t.Error("It need to return input error.")
+	}
+	if _, ok, err := registeredToken(nil, devices[2]); ok || err != nil {
+		t.Errorf("%v, %v", ok, err)
+	}
+}
@@ -0,0 +1,298 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ErrInterrupted is returned when the prompt is interrupted with Ctrl-C or canceled with ESC
+var ErrInterrupted = errors.New("interrupted")
+
+// PageSize is the number of the items shown at once
+const PageSize = 10
+
+// UI asks the user with arrow-key selection and masked input on the terminal
+type UI struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+}
+
+// New creates a UI of the terminal, which is put into raw mode while reading keys.
+// The reader buffers in, and it is shared with the other prompts so the typed ahead input is not lost.
+func New(in *os.File, reader *bufio.Reader, out io.Writer) *UI {
+	return &UI{
+		in:  reader,
+		out: out,
+		fd:  int(in.Fd()),
+	}
+}
+
+// NewWithReader creates a UI reading keys from the reader without raw mode, and a *bufio.Reader is shared as it is
+func NewWithReader(in io.Reader, out io.Writer) *UI {
+	return &UI{
+		in:  bufio.NewReader(in),
+		out: out,
+		fd:  -1,
+	}
+}
+
+// IsTerminal returns true if the file is a terminal
+func IsTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+func (u *UI) raw() (func(), error) {
+	if u.fd < 0 {
+		return func() {}, nil
+	}
+	state, err := terminal.MakeRaw(u.fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		terminal.Restore(u.fd, state)
+	}, nil
+}
+
+type key int
+
+const (
+	keyRune key = iota
+	keyUp
+	keyDown
+	keyEnter
+	keyBackspace
+	keyInterrupt
+	keyEscape
+	keyIgnored
+)
+
+func (u *UI) readKey() (key, rune, error) {
+	r, _, err := u.in.ReadRune()
+	if err != nil {
+		return keyIgnored, 0, err
+	}
+	switch r {
+	case '\r', '\n':
+		return keyEnter, r, nil
+	case 0x7f, 0x08:
+		return keyBackspace, r, nil
+	case 0x03, 0x04:
+		return keyInterrupt, r, nil
+	case 0x10:
+		return keyUp, r, nil
+	case 0x0e:
+		return keyDown, r, nil
+	case 0x1b:
+		// the terminal writes the escape sequence at once, so a lone ESC has nothing buffered after it
+		if u.in.Buffered() == 0 {
+			return keyEscape, r, nil
+		}
+		next, _, err := u.in.ReadRune()
+		if err != nil {
+			return keyIgnored, 0, err
+		}
+		if next != '[' && next != 'O' {
+			return keyIgnored, next, nil
+		}
+		code, _, err := u.in.ReadRune()
+		if err != nil {
+			return keyIgnored, 0, err
+		}
+		switch code {
+		case 'A':
+			return keyUp, code, nil
+		case 'B':
+			return keyDown, code, nil
+		}
+		return keyIgnored, code, nil
+	}
+	if unicode.IsPrint(r) {
+		return keyRune, r, nil
+	}
+	return keyIgnored, r, nil
+}
+
+// Match returns true if the characters of the pattern appear in the item in order, ignoring case
+func Match(pattern string, item string) bool {
+	item = strings.ToLower(item)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(item, r)
+		if i < 0 {
+			return false
+		}
+		item = item[i+len(string(r)):]
+	}
+	return true
+}
+
+// Select returns the index of the item chosen with the arrow keys, filtering the items by typing
+func (u *UI) Select(message string, items []string) (int, error) {
+	restore, err := u.raw()
+	if err != nil {
+		return 0, err
+	}
+	defer restore()
+
+	filter := ""
+	cursor := 0
+	lines := 0
+	for {
+		matched := []int{}
+		for i, item := range items {
+			if Match(filter, item) {
+				matched = append(matched, i)
+			}
+		}
+		if cursor >= len(matched) {
+			cursor = len(matched) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+		lines = u.render(lines, message, filter, items, matched, cursor)
+
+		k, r, err := u.readKey()
+		if err != nil {
+			return 0, err
+		}
+		switch k {
+		case keyUp:
+			if cursor > 0 {
+				cursor--
+			}
+		case keyDown:
+			if cursor < len(matched)-1 {
+				cursor++
+			}
+		case keyBackspace:
+			if filter != "" {
+				runes := []rune(filter)
+				filter = string(runes[:len(runes)-1])
+			}
+		case keyRune:
+			filter += string(r)
+			cursor = 0
+		case keyInterrupt, keyEscape:
+			u.clear(lines)
+			return 0, ErrInterrupted
+		case keyEnter:
+			if len(matched) == 0 {
+				continue
+			}
+			u.clear(lines)
+			fmt.Fprintf(u.out, "%s%s\r\n", message, items[matched[cursor]])
+			return matched[cursor], nil
+		}
+	}
+}
+
+// render draws the prompt over the previous lines, and returns the number of the drawn lines
+func (u *UI) render(previous int, message string, filter string, items []string, matched []int, cursor int) int {
+	u.clear(previous)
+	fmt.Fprintf(u.out, "%s%s\r\n", message, filter)
+	start := 0
+	if cursor >= PageSize {
+		start = cursor - PageSize + 1
+	}
+	lines := 1
+	for i := start; i < len(matched) && i < start+PageSize; i++ {
+		marker := "  "
+		if i == cursor {
+			marker = "> "
+		}
+		fmt.Fprintf(u.out, "%s%s\r\n", marker, items[matched[i]])
+		lines++
+	}
+	if len(matched) == 0 {
+		fmt.Fprint(u.out, "  (no match)\r\n")
+		lines++
+	}
+	return lines
+}
+
+// clear erases the lines drawn above the cursor
+func (u *UI) clear(lines int) {
+	if lines > 0 {
+		fmt.Fprintf(u.out, "\x1b[%dA\r\x1b[J", lines)
+	}
+}
+
+// Input reads a line showing * instead of the characters if masked
+func (u *UI) Input(message string, masked bool) (string, error) {
+	restore, err := u.raw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	fmt.Fprint(u.out, message)
+	var value []rune
+	for {
+		k, r, err := u.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch k {
+		case keyRune:
+			value = append(value, r)
+			if masked {
+				fmt.Fprint(u.out, "*")
+			} else {
+				fmt.Fprint(u.out, string(r))
+			}
+		case keyBackspace:
+			if len(value) > 0 {
+				value = value[:len(value)-1]
+				fmt.Fprint(u.out, "\b \b")
+			}
+		case keyInterrupt, keyEscape:
+			fmt.Fprint(u.out, "\r\n")
+			return "", ErrInterrupted
+		case keyEnter:
+			fmt.Fprint(u.out, "\r\n")
+			return string(value), nil
+		}
+	}
+}
+
+// spinnerFrames are drawn in turn while waiting
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spin draws a spinner with the countdown of the timeout until the returned function is called
+func (u *UI) Spin(message string, timeout time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	deadline := time.Now().Add(timeout)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			remaining := time.Until(deadline).Round(time.Second)
+			if remaining < 0 {
+				remaining = 0
+			}
+			fmt.Fprintf(u.out, "\r\x1b[K%s %s (%v)", spinnerFrames[frame%len(spinnerFrames)], message, remaining)
+			select {
+			case <-stop:
+				fmt.Fprint(u.out, "\r\x1b[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		item    string
+		want    bool
+	}{
+		{pattern: "", item: "Google Authenticator", want: true},
+		{pattern: "gauth", item: "Google Authenticator", want: true},
+		{pattern: "NOTIFY", item: "Notify to OneLogin Protect", want: true},
+		{pattern: "prod", item: "arn:aws:iam::123456789012:role/production", want: true},
+		{pattern: "tg", item: "Google Authenticator", want: false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.item); got != tt.want {
+			t.Errorf("Match(%s, %s) %v is not equal %v", tt.pattern, tt.item, got, tt.want)
+		}
+	}
+}
+
+func TestUI_Select(t *testing.T) {
+	items := []string{"OneLogin Protect", "Notify to OneLogin Protect", "Google Authenticator"}
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "enter", input: "\r", want: 0},
+		{name: "arrow keys", input: "\x1b[B\x1b[B\x1b[A\r", want: 1},
+		{name: "stop at the end", input: "\x1b[B\x1b[B\x1b[B\x1b[B\r", want: 2},
+		{name: "fuzzy search", input: "gauth\r", want: 2},
+		{name: "backspace", input: "gx\x7f\x7fnotify\r", want: 1},
+		{name: "no match", input: "xyz\r\x7f\x7f\x7f\x0e\r", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := NewWithReader(strings.NewReader(tt.input), &out).Select("Select your MFA device: ", items)
+			if err != nil {
+				t.Errorf("%#v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%d is not equal %d", got, tt.want)
+			}
+		})
+	}
+	if _, err := NewWithReader(strings.NewReader("\x03"), &bytes.Buffer{}).Select("", items); err != ErrInterrupted {
+		t.Errorf("%v is not equal %v", err, ErrInterrupted)
+	}
+	// a lone ESC cancels without waiting for the rest of an escape sequence
+	if _, err := NewWithReader(strings.NewReader("\x1b"), &bytes.Buffer{}).Select("", items); err != ErrInterrupted {
+		t.Errorf("%v is not equal %v", err, ErrInterrupted)
+	}
+}
+
+func TestUI_SharedReader(t *testing.T) {
+	// the input typed ahead of the second prompt is kept in the shared reader
+	reader := bufio.NewReader(strings.NewReader("notify\r123456\r"))
+	selected, err := NewWithReader(reader, &bytes.Buffer{}).Select("", []string{"Google Authenticator", "Notify to OneLogin Protect"})
+	if err != nil || selected != 1 {
+		t.Errorf("%d, %v is not equal 1", selected, err)
+	}
+	token, err := NewWithReader(reader, &bytes.Buffer{}).Input("", false)
+	if err != nil || token != "123456" {
+		t.Errorf("%s, %v is not equal 123456", token, err)
+	}
+}
+
+func TestUI_Input(t *testing.T) {
+	var out bytes.Buffer
+	got, err := NewWithReader(strings.NewReader("pass\x7fsword\r"), &out).Input("Enter your password: ", true)
+	if err != nil {
+		t.Errorf("%#v", err)
+	}
+	if got != "password" {
+		t.Errorf("%s is not equal %s", got, "password")
+	}
+	if strings.Contains(out.String(), "password") && !strings.HasPrefix(out.String(), "Enter your password") {
+		t.Errorf("%s shows the masked input", out.String())
+	}
+	if strings.Contains(strings.TrimPrefix(out.String(), "Enter your password: "), "s") {
+		t.Errorf("%q shows the masked input", out.String())
+	}
+	if _, err := NewWithReader(strings.NewReader("12\x03"), &bytes.Buffer{}).Input("", false); err != ErrInterrupted {
+		t.Errorf("%v is not equal %v", err, ErrInterrupted)
+	}
+}
+
+func TestUI_Spin(t *testing.T) {
+	var out bytes.Buffer
+	stop := NewWithReader(strings.NewReader(""), &out).Spin("Waiting for approval", time.Minute)
+	time.Sleep(150 * time.Millisecond)
+	stop()
+	if !strings.Contains(out.String(), "Waiting for approval (1m0s)") && !strings.Contains(out.String(), "Waiting for approval (59s)") {
+		t.Errorf("%q does not show the countdown", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "\r\x1b[K") {
+		t.Errorf("%q does not clear the spinner", out.String())
+	}
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/spf13/cobra"
 )
@@ -34,7 +35,10 @@ var versionCmd = &cobra.Command{
 		if Version == "" {
 			Version = "Unknown"
 		}
-		fmt.Println(fmt.Sprintf("OneLogin AWS Connector version: %v", Version))
+		printResult(map[string]string{"version": Version}, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "OneLogin AWS Connector version: %v\n", Version)
+			return err
+		})
 	},
 }
 
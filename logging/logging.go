@@ -0,0 +1,207 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is the severity of the log
+type Level int
+
+const (
+	// DebugLevel is the diagnostic log printed with --debug
+	DebugLevel Level = iota
+	// InfoLevel is the progress of the long running commands
+	InfoLevel
+	// WarnLevel is the problem which does not stop the command
+	WarnLevel
+	// ErrorLevel is the failure of the command
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// Levels are the names of the levels
+var Levels = append([]string{}, levelNames...)
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of the name
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, errors.Errorf("%s is not supported log level (%s)", name, strings.Join(levelNames, ", "))
+}
+
+// Field is the key and the value attached to the log
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns the field of the key and the value
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes the leveled logs with the fields as key=value pairs.
+// The values of the secret keys are redacted unless ShowSecrets is enabled.
+type Logger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	level   Level
+	secrets bool
+	now     func() time.Time
+}
+
+// New returns a Logger writing the logs of the level or above to out
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{
+		out:   out,
+		level: level,
+		now:   time.Now,
+	}
+}
+
+// SetOutput changes the writer of the logs
+func (l *Logger) SetOutput(out io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = out
+}
+
+// SetLevel changes the lowest level of the logs written
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// ShowSecrets stops the redaction of the secret values, which is only for the emergencies
+func (l *Logger) ShowSecrets(show bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.secrets = show
+}
+
+// Enabled returns true if the logs of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// Debug writes the log in the debug level
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.write(DebugLevel, msg, fields)
+}
+
+// Info writes the log in the info level
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.write(InfoLevel, msg, fields)
+}
+
+// Warn writes the log in the warn level
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.write(WarnLevel, msg, fields)
+}
+
+// Error writes the log in the error level
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.write(ErrorLevel, msg, fields)
+}
+
+func (l *Logger) write(level Level, msg string, fields []Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(l.now().Format("2006/01/02 15:04:05"))
+	b.WriteString(" " + strings.ToUpper(level.String()) + " " + msg)
+	for _, f := range fields {
+		b.WriteString(" " + f.Key + "=" + quote(l.format(f.Key, f.Value)))
+	}
+	b.WriteString("\n")
+	io.WriteString(l.out, b.String())
+}
+
+// format renders the value of the key with the secrets redacted
+func (l *Logger) format(key string, value interface{}) string {
+	if l.secrets {
+		return fmt.Sprintf("%+v", value)
+	}
+	return redact(key, value)
+}
+
+// quote quotes the value if it is not a single word
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// std is the logger of the package level functions, which is used across the commands and the API clients
+var std = New(os.Stderr, InfoLevel)
+
+// Default returns the logger of the package level functions
+func Default() *Logger {
+	return std
+}
+
+// SetOutput changes the writer of the default logger
+func SetOutput(out io.Writer) {
+	std.SetOutput(out)
+}
+
+// SetLevel changes the level of the default logger
+func SetLevel(level Level) {
+	std.SetLevel(level)
+}
+
+// ShowSecrets stops the redaction of the default logger
+func ShowSecrets(show bool) {
+	std.ShowSecrets(show)
+}
+
+// Enabled returns true if the default logger writes the logs of the level
+func Enabled(level Level) bool {
+	return std.Enabled(level)
+}
+
+// Debug writes the log in the debug level with the default logger
+func Debug(msg string, fields ...Field) {
+	std.Debug(msg, fields...)
+}
+
+// Info writes the log in the info level with the default logger
+func Info(msg string, fields ...Field) {
+	std.Info(msg, fields...)
+}
+
+// Warn writes the log in the warn level with the default logger
+func Warn(msg string, fields ...Field) {
+	std.Warn(msg, fields...)
+}
+
+// Error writes the log in the error level with the default logger
+func Error(msg string, fields ...Field) {
+	std.Error(msg, fields...)
+}
@@ -0,0 +1,263 @@
+package logging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted replaces the secret values in the logs
+const Redacted = "[REDACTED]"
+
+// maxBody is the length of the HTTP bodies in the logs
+const maxBody = 4096
+
+// secretWords are the parts of the keys holding the secrets,
+// which are compared in lower case without the separators
+var secretWords = []string{
+	"secret",
+	"password",
+	"passphrase",
+	"accesstoken",
+	"refreshtoken",
+	"sessiontoken",
+	"securitytoken",
+	"statetoken",
+	"otptoken",
+	"signintoken",
+	"authorization",
+	"cookie",
+	"saml",
+}
+
+// IsSecret returns true if the value of the key is redacted,
+// such as ClientSecret, client_secret, Password, AccessToken, SessionToken and SAMLResponse
+func IsSecret(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(key))
+	if normalized == "token" {
+		return true
+	}
+	for _, word := range secretWords {
+		if strings.Contains(normalized, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact renders the value of the key, and the secret fields in the structs and the maps are redacted.
+// fmt.Stringer of the structs is not used, because the String of the AWS SDK types prints the secrets.
+func redact(key string, value interface{}) string {
+	if IsSecret(key) && !empty(value) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.String()
+	case string:
+		if looksSAML(v) {
+			return Redacted
+		}
+		return v
+	case []byte:
+		return fmt.Sprintf("[%d bytes]", len(v))
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return "<nil>"
+		}
+		return redact(key, rv.Elem().Interface())
+	case reflect.Struct:
+		parts := []string{}
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			parts = append(parts, field.Name+":"+redact(field.Name, rv.Field(i).Interface()))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	case reflect.Map:
+		parts := []string{}
+		for _, k := range rv.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			parts = append(parts, name+":"+redact(name, rv.MapIndex(k).Interface()))
+		}
+		sort.Strings(parts)
+		return "map[" + strings.Join(parts, " ") + "]"
+	case reflect.Slice, reflect.Array:
+		parts := []string{}
+		for i := 0; i < rv.Len(); i++ {
+			parts = append(parts, redact("", rv.Index(i).Interface()))
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// empty returns true if the value tells nothing even without the redaction
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			return true
+		}
+	}
+	return rv.Kind() == reflect.String && rv.Len() == 0
+}
+
+// looksSAML returns true if the value is the base64 encoded SAML response,
+// which is sent in the fields not named as the secret such as "data"
+func looksSAML(value string) bool {
+	if len(value) < 64 {
+		return false
+	}
+	data, err := base64.StdEncoding.DecodeString(value[:48])
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "<")
+}
+
+// ScrubBody returns the HTTP body with the secret values redacted.
+// JSON, form and XML bodies are scrubbed by the keys, and the other bodies are only counted.
+func ScrubBody(contentType string, body []byte) string {
+	trimmed := strings.TrimSpace(string(body))
+	if trimmed == "" {
+		return ""
+	}
+	var scrubbed string
+	switch {
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return fmt.Sprintf("[%d bytes of invalid JSON]", len(body))
+		}
+		data, err := json.Marshal(scrubJSON("", value))
+		if err != nil {
+			return fmt.Sprintf("[%d bytes]", len(body))
+		}
+		scrubbed = string(data)
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		values, err := url.ParseQuery(trimmed)
+		if err != nil {
+			return fmt.Sprintf("[%d bytes of invalid form]", len(body))
+		}
+		scrubbed = scrubForm(values)
+	case strings.HasPrefix(trimmed, "<"):
+		scrubbed = scrubXML(trimmed)
+	default:
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	if len(scrubbed) > maxBody {
+		return scrubbed[:maxBody] + "...(truncated)"
+	}
+	return scrubbed
+}
+
+func scrubJSON(key string, value interface{}) interface{} {
+	if IsSecret(key) && !empty(value) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		scrubbed := map[string]interface{}{}
+		for k, item := range v {
+			scrubbed[k] = scrubJSON(k, item)
+		}
+		return scrubbed
+	case []interface{}:
+		scrubbed := make([]interface{}, len(v))
+		for i, item := range v {
+			scrubbed[i] = scrubJSON("", item)
+		}
+		return scrubbed
+	case string:
+		if looksSAML(v) {
+			return Redacted
+		}
+	}
+	return value
+}
+
+// scrubForm encodes the form values, and the redacted values are not escaped to be readable
+func scrubForm(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		for _, v := range values[k] {
+			if (IsSecret(k) && v != "") || looksSAML(v) {
+				parts = append(parts, url.QueryEscape(k)+"="+Redacted)
+				continue
+			}
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+var xmlText = regexp.MustCompile(`<((?:[A-Za-z_][\w.-]*:)?([A-Za-z_][\w.-]*))(\s[^>]*)?>([^<]+)</`)
+
+// scrubXML redacts the text of the secret elements such as SecretAccessKey and SessionToken
+func scrubXML(body string) string {
+	return xmlText.ReplaceAllStringFunc(body, func(match string) string {
+		m := xmlText.FindStringSubmatch(match)
+		if !IsSecret(m[2]) && !looksSAML(m[4]) {
+			return match
+		}
+		return "<" + m[1] + m[3] + ">" + Redacted + "</"
+	})
+}
+
+// RedactURL returns the URL with the secret query values and the password redacted
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		if _, ok := redacted.User.Password(); ok {
+			redacted.User = url.UserPassword(redacted.User.Username(), Redacted)
+		}
+	}
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for k, values := range query {
+			for i, v := range values {
+				if (IsSecret(k) && v != "") || looksSAML(v) {
+					values[i] = Redacted
+				}
+			}
+			query[k] = values
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// headers flattens the headers to the map, whose secret values are redacted in the logs
+func headers(header map[string][]string) map[string]string {
+	m := map[string]string{}
+	for k, values := range header {
+		m[k] = strings.Join(values, ", ")
+	}
+	return m
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Transport traces the HTTP requests and the responses in the debug level,
+// and the secrets in the headers and the bodies are redacted
+type Transport struct {
+	// Base is the round tripper sending the requests, http.DefaultTransport if it is nil
+	Base http.RoundTripper
+	// Logger writes the traces, the default logger if it is nil
+	Logger *Logger
+}
+
+// NewTransport returns the Transport tracing the round tripper with the default logger
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// RoundTrip sends the request with the base round tripper, and traces it if the debug level is enabled
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	logger := t.Logger
+	if logger == nil {
+		logger = std
+	}
+	if !logger.Enabled(DebugLevel) {
+		return base.RoundTrip(req)
+	}
+	body, req, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("HTTP request",
+		F("method", req.Method),
+		F("url", logger.url(req)),
+		F("header", headers(req.Header)),
+		F("body", logger.scrub(req.Header.Get("Content-Type"), body)),
+	)
+	start := time.Now()
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		logger.Debug("HTTP error", F("url", logger.url(req)), F("duration", time.Since(start)), F("error", err))
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	logger.Debug("HTTP response",
+		F("url", logger.url(req)),
+		F("status", res.StatusCode),
+		F("duration", time.Since(start)),
+		F("header", headers(res.Header)),
+		F("body", logger.scrub(res.Header.Get("Content-Type"), data)),
+	)
+	return res, nil
+}
+
+// requestBody returns the body of the request, and the clone of the request which is sent instead.
+// GetBody is not used, because AWS SDK replaces the body without it.
+func requestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, clone, nil
+}
+
+func (l *Logger) url(req *http.Request) string {
+	if l.showing() {
+		return req.URL.String()
+	}
+	return RedactURL(req.URL)
+}
+
+// scrub returns the body with the secrets redacted, or as it is with ShowSecrets
+func (l *Logger) scrub(contentType string, body []byte) string {
+	if l.showing() {
+		return string(body)
+	}
+	return ScrubBody(contentType, body)
+}
+
+func (l *Logger) showing() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.secrets
+}
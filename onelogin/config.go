@@ -1,34 +1,73 @@
 package onelogin
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 
 	"github.com/BurntSushi/toml"
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/credentials"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/tokens"
+	"github.com/pkg/errors"
 )
 
 // CacheDir is credentials cache dir
 var CacheDir string
 
+// SecretStore saves the credentials cache outside of the plaintext files
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key string, value string) error
+}
+
+// Store is used for the credentials cache instead of CacheDir if it is set
+var Store SecretStore
+
 // Config provides configuration for API Clients
 type Config struct {
 	Endpoint     string
 	ClientToken  string
 	ClientSecret string
 	Credentials  *credentials.Credentials
+	// HTTPClient is shared by the API clients of the Config
+	HTTPClient *http.Client
+}
+
+// CachedCredentials returns the credentials cache of the client token in Store or CacheDir,
+// or nil if there is no cache. The tokens of the cache may be expired.
+func CachedCredentials(clientToken string) *credentials.Value {
+	var c credentials.Value
+	if Store != nil {
+		data, err := Store.Get(cacheKey(clientToken))
+		if err != nil {
+			return nil
+		}
+		if _, err := toml.Decode(data, &c); err != nil {
+			return nil
+		}
+		return &c
+	}
+	if _, err := toml.DecodeFile(cacheFile(clientToken), &c); err != nil {
+		return nil
+	}
+	return &c
 }
 
 // NewConfig returns a new Config pointer
 func NewConfig(endpoint string, clientToken string, clientSecret string) *Config {
-	var c credentials.Value
-	var v *credentials.Value
-	if _, err := toml.DecodeFile(cacheFile(clientToken), &c); err == nil {
-		v = &c
+	v := CachedCredentials(clientToken)
+	if v != nil {
+		logging.Debug("use OneLogin token cache", logging.F("AccessExpiresAt", v.AccessExpiresAt), logging.F("RefreshExpiresAt", v.RefreshExpiresAt))
 	}
 	t := tokens.NewTokens()
+	client := t.HTTPClient
 	t.Endpoint = endpoint
 	t.ClientToken = clientToken
 	t.ClientSecret = clientSecret
@@ -37,7 +76,35 @@ func NewConfig(endpoint string, clientToken string, clientSecret string) *Config
 		ClientToken:  clientToken,
 		ClientSecret: clientSecret,
 		Credentials:  credentials.New(t, v),
+		HTTPClient:   client,
+	}
+}
+
+// UseCABundle trusts the certificates in the PEM file in addition to the system certificates,
+// such as the certificate of the corporate proxy or the local mock server
+func (c *Config) UseCABundle(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
 	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.Errorf("there is no certificate in CA bundle %s", file)
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+	// the clone keeps the proxy, the timeouts and HTTP/2 of the default transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.RootCAs = pool
+	c.HTTPClient.Transport = logging.NewTransport(transport)
+	return nil
 }
 
 // Refresh load new credentials if necessary
@@ -47,6 +114,22 @@ func (c *Config) Refresh() error {
 
 // Save seves credentials value
 func (c *Config) Save() error {
+	return c.SaveWithContext(context.Background())
+}
+
+// SaveWithContext is Save canceled with the context
+func (c *Config) SaveWithContext(ctx context.Context) error {
+	if Store != nil {
+		creds, err := c.Credentials.GetWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(&creds); err != nil {
+			return err
+		}
+		return Store.Set(cacheKey(c.ClientToken), buf.String())
+	}
 	if CacheDir != "" {
 		fd, err := os.Create(cacheFile(c.ClientToken))
 		if err != nil {
@@ -54,7 +137,7 @@ func (c *Config) Save() error {
 		}
 		defer fd.Close()
 		encoder := toml.NewEncoder(fd)
-		creds, err := c.Credentials.Get()
+		creds, err := c.Credentials.GetWithContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -63,6 +146,10 @@ func (c *Config) Save() error {
 	return nil
 }
 
+func cacheKey(clientToken string) string {
+	return fmt.Sprintf("onelogin.%s.cache", clientToken)
+}
+
 func cacheFile(clientToken string) string {
-	return path.Join(CacheDir, fmt.Sprintf("onelogin.%s.cache", clientToken))
+	return path.Join(CacheDir, cacheKey(clientToken))
 }
@@ -1,8 +1,12 @@
 package onelogin
 
 import (
+	"context"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"testing"
@@ -88,6 +92,10 @@ func (t *TokensAPIMock) Generate() (*tokens.GenerateResponse, error) {
 	return t.GenerateResponse, t.GenerateError
 }
 
+func (t *TokensAPIMock) GenerateWithContext(ctx context.Context) (*tokens.GenerateResponse, error) {
+	return t.Generate()
+}
+
 // There is tested only no credentials.
 // Other patterns are tested in onelogin/credentials package.
 func TestRefresh(t *testing.T) {
@@ -200,3 +208,98 @@ func TestSaveError(t *testing.T) {
 		t.Error("file size is not zero")
 	}
 }
+
+type SecretStoreMock map[string]string
+
+func (s SecretStoreMock) Get(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", fmt.Errorf("%s is not exists", key)
+	}
+	return value, nil
+}
+
+func (s SecretStoreMock) Set(key string, value string) error {
+	s[key] = value
+	return nil
+}
+
+func TestSaveStore(t *testing.T) {
+	CacheDir = os.TempDir()
+	store := SecretStoreMock{}
+	Store = store
+	defer func() {
+		Store = nil
+	}()
+	var v *credentials.Value
+	now := time.Now()
+	a := &TokensAPIMock{
+		GenerateResponse: &tokens.GenerateResponse{
+			AccessToken:  "access-token",
+			RefreshToken: "refresh-token",
+			CreatedAt:    now.Format("2006-01-02T15:04:05Z"),
+			ExpiresIn:    10,
+			AccountID:    1234567,
+			TokenType:    "bearer",
+		},
+	}
+	c := Config{
+		Endpoint:     "endpoint",
+		ClientToken:  "client-token",
+		ClientSecret: "client-secret",
+		Credentials:  credentials.New(a, v),
+	}
+	if err := c.Save(); err != nil {
+		t.Errorf("%#v", err)
+	}
+	if _, ok := store["onelogin.client-token.cache"]; !ok {
+		t.Errorf("credentials are not stored: %#v", store)
+	}
+
+	config := NewConfig("endpoint", "client-token", "client-secret")
+	creds := config.Credentials.Credentials
+	if creds == nil {
+		t.Fatal("credentials are not loaded from the store")
+	}
+	if creds.AccessToken != "access-token" {
+		t.Errorf("%v is not equal %v", creds.AccessToken, "access-token")
+	}
+}
+
+func TestUseCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	file := path.Join(os.TempDir(), "onelogin.ca-bundle.pem")
+	defer os.Remove(file)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	c := NewConfig("endpoint", "client-token", "client-secret")
+	if _, err := c.HTTPClient.Get(ts.URL); err == nil {
+		t.Error("It need to return certificate error.")
+	}
+	if err := c.UseCABundle(file); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	res, err := c.HTTPClient.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	res.Body.Close()
+}
+
+func TestUseCABundleError(t *testing.T) {
+	file := path.Join(os.TempDir(), "onelogin.ca-bundle.pem")
+	defer os.Remove(file)
+	if err := ioutil.WriteFile(file, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	c := NewConfig("endpoint", "client-token", "client-secret")
+	if err := c.UseCABundle(file); err == nil {
+		t.Error("It need to return no certificate error.")
+	}
+	if err := c.UseCABundle(path.Join(os.TempDir(), "not-exists.pem")); err == nil {
+		t.Error("It need to return file not found error.")
+	}
+}
@@ -1,8 +1,10 @@
 package credentials
 
 import (
+	"context"
 	"time"
 
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/tokens"
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin/tokens/tokensiface"
 )
@@ -32,7 +34,12 @@ func New(t tokensiface.TokensAPI, c *Value) *Credentials {
 
 // Get returns the credentials value, or error
 func (c *Credentials) Get() (Value, error) {
-	if err := c.Refresh(); err != nil {
+	return c.GetWithContext(context.Background())
+}
+
+// GetWithContext is Get canceled with the context
+func (c *Credentials) GetWithContext(ctx context.Context) (Value, error) {
+	if err := c.RefreshWithContext(ctx); err != nil {
 		return Value{}, err
 	}
 	return *c.Credentials, nil
@@ -40,6 +47,11 @@ func (c *Credentials) Get() (Value, error) {
 
 // Refresh load new credentials if necessary
 func (c *Credentials) Refresh() error {
+	return c.RefreshWithContext(context.Background())
+}
+
+// RefreshWithContext is Refresh canceled with the context
+func (c *Credentials) RefreshWithContext(ctx context.Context) error {
 	var res *tokens.GenerateResponse
 	var err error
 	if c.Credentials != nil {
@@ -48,28 +60,32 @@ func (c *Credentials) Refresh() error {
 			return nil
 		}
 		if creds.refreshable() {
+			logging.Debug("refresh OneLogin access token", logging.F("AccessExpiresAt", creds.AccessExpiresAt))
 			input := &tokens.RefreshRequest{
 				AccessToken:  c.Credentials.AccessToken,
 				RefreshToken: c.Credentials.RefreshToken,
 			}
-			res, err = c.Tokens.Refresh(input)
+			res, err = c.Tokens.RefreshWithContext(ctx, input)
 			if err != nil {
 				if err.Error() != "[401] Unauthorized: Invalid Token" {
 					return err
 				}
-				res, err = c.Tokens.Generate()
+				logging.Debug("OneLogin refresh token is invalid, generate new tokens")
+				res, err = c.Tokens.GenerateWithContext(ctx)
 				if err != nil {
 					return err
 				}
 			}
 		} else {
-			res, err = c.Tokens.Generate()
+			logging.Debug("OneLogin refresh token is expired, generate new tokens", logging.F("RefreshExpiresAt", creds.RefreshExpiresAt))
+			res, err = c.Tokens.GenerateWithContext(ctx)
 			if err != nil {
 				return err
 			}
 		}
 	} else {
-		res, err = c.Tokens.Generate()
+		logging.Debug("generate OneLogin tokens")
+		res, err = c.Tokens.GenerateWithContext(ctx)
 		if err != nil {
 			return err
 		}
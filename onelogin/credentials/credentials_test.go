@@ -1,6 +1,7 @@
 package credentials
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -32,6 +33,14 @@ func (t *TokenAPIMock) Generate() (*tokens.GenerateResponse, error) {
 	return t.GenerateResponse, t.Error
 }
 
+func (t *TokenAPIMock) GenerateWithContext(ctx context.Context) (*tokens.GenerateResponse, error) {
+	return t.Generate()
+}
+
+func (t *TokenAPIMock) RefreshWithContext(ctx context.Context, input *tokens.RefreshRequest) (*tokens.RefreshResponse, error) {
+	return t.Refresh(input)
+}
+
 func (t *TokenAPIMock) Refresh(input *tokens.RefreshRequest) (*tokens.RefreshResponse, error) {
 	if err := t.RefreshRequestVerifier(input); err != nil {
 		return nil, err
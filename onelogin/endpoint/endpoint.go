@@ -0,0 +1,23 @@
+package endpoint
+
+import "strings"
+
+// Base returns the base URL of the endpoint without the trailing slash.
+// The endpoint is the host of OneLogin API such as api.us.onelogin.com,
+// or the base URL with the scheme, the port and the path prefix such as http://localhost:8080/onelogin.
+func Base(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	return strings.TrimRight(endpoint, "/")
+}
+
+// URL returns the URL of the API path on the endpoint
+func URL(endpoint string, path string) string {
+	return Base(endpoint) + path
+}
+
+// Contains returns true if the URL is under the base URL of the endpoint
+func Contains(endpoint string, url string) bool {
+	return strings.HasPrefix(url, Base(endpoint)+"/")
+}
@@ -0,0 +1,39 @@
+package endpoint
+
+import "testing"
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{endpoint: "api.us.onelogin.com", want: "https://api.us.onelogin.com/api/1/saml_assertion"},
+		{endpoint: "127.0.0.1:8443", want: "https://127.0.0.1:8443/api/1/saml_assertion"},
+		{endpoint: "http://localhost:8080", want: "http://localhost:8080/api/1/saml_assertion"},
+		{endpoint: "https://proxy.example.com/onelogin/", want: "https://proxy.example.com/onelogin/api/1/saml_assertion"},
+	}
+	for _, tt := range tests {
+		if got := URL(tt.endpoint, "/api/1/saml_assertion"); got != tt.want {
+			t.Errorf("%s is not equal %s", got, tt.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		url      string
+		want     bool
+	}{
+		{endpoint: "api.us.onelogin.com", url: "https://api.us.onelogin.com/api/2/saml_assertion/verify_factor", want: true},
+		{endpoint: "api.us.onelogin.com", url: "http://api.us.onelogin.com/api/2/saml_assertion/verify_factor", want: false},
+		{endpoint: "api.us.onelogin.com", url: "https://api.us.onelogin.com.example.com/api", want: false},
+		{endpoint: "https://proxy.example.com/onelogin", url: "https://proxy.example.com/onelogin/api/1/saml_assertion/verify_factor", want: true},
+		{endpoint: "https://proxy.example.com/onelogin", url: "https://api.us.onelogin.com/api/1/saml_assertion/verify_factor", want: false},
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.endpoint, tt.url); got != tt.want {
+			t.Errorf("Contains(%s, %s) %v is not equal %v", tt.endpoint, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,490 @@
+package mockserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+)
+
+// Scenario is the scripted behavior of the mock OneLogin server
+type Scenario string
+
+const (
+	// NoMFA returns the SAML response without MFA
+	NoMFA Scenario = "no-mfa"
+	// OTP requires the OTP token of Google Authenticator
+	OTP Scenario = "otp"
+	// Push sends the push notification to OneLogin Protect, which is pending and then approved
+	Push Scenario = "push"
+	// Denied sends the push notification to OneLogin Protect, which is pending and then denied
+	Denied Scenario = "denied"
+	// ExpiredToken issues the access tokens expiring at once, and rejects the first refresh as the invalid token,
+	// so the client generates new tokens
+	ExpiredToken Scenario = "expired-token"
+	// RateLimit rejects SAML assertion API with 429 Too Many Requests
+	RateLimit Scenario = "rate-limit"
+)
+
+// Scenarios are the names of the supported scenarios
+var Scenarios = []string{
+	string(NoMFA),
+	string(OTP),
+	string(Push),
+	string(Denied),
+	string(ExpiredToken),
+	string(RateLimit),
+}
+
+// Default values of the Server
+const (
+	DefaultClientToken     = "mock-client-token"
+	DefaultClientSecret    = "mock-client-secret"
+	DefaultUsernameOrEmail = "user@example.com"
+	DefaultPassword        = "password"
+	DefaultOTPToken        = "123456"
+	DefaultPendingPolls    = 2
+	DefaultIssuer          = "https://app.onelogin.com/saml/metadata/mock"
+)
+
+// DefaultRoles are the AWS roles in the SAML responses by default
+var DefaultRoles = []saml.Role{
+	{
+		RoleArn:      "arn:aws:iam::123456789012:role/Admin",
+		PrincipalArn: "arn:aws:iam::123456789012:saml-provider/OneLogin",
+	},
+	{
+		RoleArn:      "arn:aws:iam::123456789012:role/ReadOnly",
+		PrincipalArn: "arn:aws:iam::123456789012:saml-provider/OneLogin",
+	},
+}
+
+// Device IDs of the MFA devices
+const (
+	otpDeviceID     = 111111
+	protectDeviceID = 222222
+)
+
+// Server fakes OneLogin Generate Tokens API, SAML assertion API v1 and v2 and AWS STS on "/sts".
+// The fake STS answers AssumeRoleWithSAML, AssumeRole and GetCallerIdentity.
+// The SAML responses are signed with the key generated by New, and only they are accepted by the fake STS.
+type Server struct {
+	Scenario        Scenario
+	ClientToken     string
+	ClientSecret    string
+	UsernameOrEmail string
+	Password        string
+	// OTPToken is the token accepted by the MFA devices
+	OTPToken string
+	// PendingPolls is the number of the verify factor requests answered as pending
+	// before the push notification is approved or denied
+	PendingPolls int
+	// Roles are the AWS roles in the SAML responses
+	Roles  []saml.Role
+	Issuer string
+	// Prefix is the path prefix of the base URL such as "/onelogin", which the server is mounted under
+	Prefix string
+
+	key         *rsa.PrivateKey
+	certificate []byte
+	mu          sync.Mutex
+	tokens      map[string]bool
+	refreshes   map[string]bool
+	states      map[string]int
+	// revoked is set when the refresh of ExpiredToken is rejected
+	revoked bool
+	// accessKeys are the users assumed by the access keys issued by the fake STS
+	accessKeys map[string]assumedRoleUser
+}
+
+// status is the status of OneLogin API v1
+type status struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Error   bool   `json:"error"`
+	Code    int    `json:"code"`
+}
+
+type statusResponse struct {
+	Status status `json:"status"`
+}
+
+// errorResponseV2 is the error of OneLogin API v2 answered with the HTTP status
+type errorResponseV2 struct {
+	StatusCode int    `json:"statusCode"`
+	Name       string `json:"name"`
+	Message    string `json:"message"`
+}
+
+// responseV2 is the response of OneLogin API v2 with or without MFA
+type responseV2 struct {
+	Data        string   `json:"data,omitempty"`
+	Message     string   `json:"message"`
+	StateToken  string   `json:"state_token,omitempty"`
+	Devices     []device `json:"devices,omitempty"`
+	CallbackURL string   `json:"callback_url,omitempty"`
+	User        *user    `json:"user,omitempty"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	CreatedAt    string `json:"created_at"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	AccountID    int    `json:"account_id"`
+}
+
+type samlResponse struct {
+	Status status `json:"status"`
+	Data   string `json:"data"`
+}
+
+type factorsResponse struct {
+	Status status   `json:"status"`
+	Data   []factor `json:"data"`
+}
+
+type factor struct {
+	StateToken  string   `json:"state_token"`
+	Devices     []device `json:"devices"`
+	CallbackURL string   `json:"callback_url"`
+	User        user     `json:"user"`
+}
+
+type device struct {
+	DeviceID   int    `json:"device_id"`
+	DeviceType string `json:"device_type"`
+}
+
+type user struct {
+	UserName string `json:"username"`
+	Email    string `json:"email"`
+	ID       int    `json:"id"`
+}
+
+// New creates a Server of the scenario with the default values
+func New(scenario Scenario) (*Server, error) {
+	valid := false
+	for _, s := range Scenarios {
+		valid = valid || s == string(scenario)
+	}
+	if !valid {
+		return nil, errors.Errorf("%s scenario is not supported (%s)", scenario, strings.Join(Scenarios, ", "))
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "onelogin-aws-connector mock-server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		Scenario:        scenario,
+		ClientToken:     DefaultClientToken,
+		ClientSecret:    DefaultClientSecret,
+		UsernameOrEmail: DefaultUsernameOrEmail,
+		Password:        DefaultPassword,
+		OTPToken:        DefaultOTPToken,
+		PendingPolls:    DefaultPendingPolls,
+		Roles:           DefaultRoles,
+		Issuer:          DefaultIssuer,
+		key:             key,
+		certificate:     certificate,
+		tokens:          map[string]bool{},
+		refreshes:       map[string]bool{},
+		states:          map[string]int{},
+		accessKeys:      map[string]assumedRoleUser{},
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeStatus(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	prefix := strings.TrimRight(s.Prefix, "/")
+	if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		writeStatus(w, http.StatusNotFound, r.URL.Path+" is not found")
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, prefix) {
+	case "/auth/oauth2/v2/token":
+		s.token(w, r)
+	case "/api/1/saml_assertion":
+		s.samlAssertion(w, r, 1)
+	case "/api/1/saml_assertion/verify_factor":
+		s.verifyFactor(w, r, 1)
+	case "/api/2/saml_assertion":
+		s.samlAssertion(w, r, 2)
+	case "/api/2/saml_assertion/verify_factor":
+		s.verifyFactor(w, r, 2)
+	case "/sts", "/sts/":
+		s.sts(w, r)
+	default:
+		writeStatus(w, http.StatusNotFound, r.URL.Path+" is not found")
+	}
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GrantType    string `json:"grant_type"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch input.GrantType {
+	case "client_credentials":
+		if r.Header.Get("Authorization") != fmt.Sprintf("client_id:%s, client_secret:%s", s.ClientToken, s.ClientSecret) {
+			writeStatus(w, http.StatusUnauthorized, "Authentication Failure")
+			return
+		}
+	case "refresh_token":
+		if !s.refreshes[input.RefreshToken] {
+			writeStatus(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		delete(s.refreshes, input.RefreshToken)
+		if s.Scenario == ExpiredToken && !s.revoked {
+			s.revoked = true
+			writeStatus(w, http.StatusUnauthorized, "Invalid Token")
+			return
+		}
+	default:
+		writeStatus(w, http.StatusBadRequest, "Invalid grant_type")
+		return
+	}
+	expiresIn := 36000
+	if s.Scenario == ExpiredToken {
+		expiresIn = 0
+	}
+	output := &tokenResponse{
+		AccessToken:  randomHex(32),
+		CreatedAt:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ExpiresIn:    expiresIn,
+		RefreshToken: randomHex(32),
+		TokenType:    "bearer",
+		AccountID:    123456,
+	}
+	s.tokens[output.AccessToken] = true
+	s.refreshes[output.RefreshToken] = true
+	writeJSON(w, http.StatusOK, output)
+}
+
+// authorize writes the error response and returns false if the request can not call SAML assertion API
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, version int) bool {
+	token := r.Header.Get("Authorization")
+	if version == 1 {
+		token = strings.TrimPrefix(token, "bearer:")
+	} else {
+		token = strings.TrimPrefix(token, "Bearer ")
+	}
+	s.mu.Lock()
+	valid := s.tokens[token]
+	s.mu.Unlock()
+	switch {
+	case !valid:
+		writeError(w, version, http.StatusUnauthorized, "Authorization Information is incorrect")
+	case s.Scenario == RateLimit:
+		w.Header().Set("Retry-After", "60")
+		writeError(w, version, http.StatusTooManyRequests, "Rate limit exceeded")
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *Server) samlAssertion(w http.ResponseWriter, r *http.Request, version int) {
+	if !s.authorize(w, r, version) {
+		return
+	}
+	var input struct {
+		UsernameOrEmail string `json:"username_or_email"`
+		Password        string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, version, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.UsernameOrEmail != s.UsernameOrEmail || input.Password != s.Password {
+		writeError(w, version, http.StatusUnauthorized, "Authentication Failed: Invalid user credentials")
+		return
+	}
+	var devices []device
+	switch s.Scenario {
+	case OTP:
+		devices = []device{{DeviceID: otpDeviceID, DeviceType: "Google Authenticator"}}
+	case Push, Denied:
+		devices = []device{{DeviceID: protectDeviceID, DeviceType: "OneLogin Protect"}}
+	default:
+		s.writeSAML(w, version)
+		return
+	}
+	stateToken := randomHex(20)
+	s.mu.Lock()
+	s.states[stateToken] = 0
+	s.mu.Unlock()
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	message := "MFA is required for this user"
+	callbackURL := fmt.Sprintf("%s://%s%s/api/%d/saml_assertion/verify_factor", scheme, r.Host, strings.TrimRight(s.Prefix, "/"), version)
+	mfaUser := user{UserName: s.UsernameOrEmail, Email: s.UsernameOrEmail, ID: 1}
+	if version == 2 {
+		writeJSON(w, http.StatusOK, &responseV2{
+			Message:     message,
+			StateToken:  stateToken,
+			Devices:     devices,
+			CallbackURL: callbackURL,
+			User:        &mfaUser,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, &factorsResponse{
+		Status: status{Type: "success", Message: message, Code: http.StatusOK},
+		Data: []factor{
+			{
+				StateToken:  stateToken,
+				Devices:     devices,
+				CallbackURL: callbackURL,
+				User:        mfaUser,
+			},
+		},
+	})
+}
+
+func (s *Server) verifyFactor(w http.ResponseWriter, r *http.Request, version int) {
+	if !s.authorize(w, r, version) {
+		return
+	}
+	var input struct {
+		DeviceID   string `json:"device_id"`
+		StateToken string `json:"state_token"`
+		OtpToken   string `json:"otp_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, version, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	polls, ok := s.states[input.StateToken]
+	if ok {
+		s.states[input.StateToken] = polls + 1
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, version, http.StatusUnauthorized, "Invalid state_token")
+		return
+	}
+	deviceID, _ := strconv.Atoi(input.DeviceID)
+	if (s.Scenario == OTP && deviceID != otpDeviceID) || (s.Scenario != OTP && deviceID != protectDeviceID) {
+		writeError(w, version, http.StatusBadRequest, "Invalid device_id")
+		return
+	}
+	if input.OtpToken != "" {
+		if input.OtpToken != s.OTPToken {
+			writeError(w, version, http.StatusUnauthorized, "Failed authentication with this factor")
+			return
+		}
+		s.finish(input.StateToken)
+		s.writeSAML(w, version)
+		return
+	}
+	if s.Scenario == OTP {
+		writeError(w, version, http.StatusBadRequest, "otp_token is required")
+		return
+	}
+	if polls < s.PendingPolls {
+		message := "Authentication pending on OL Protect"
+		if version == 2 {
+			writeJSON(w, http.StatusOK, &responseV2{Message: message})
+			return
+		}
+		writeJSON(w, http.StatusOK, &statusResponse{
+			Status: status{Type: "pending", Message: message, Code: http.StatusOK},
+		})
+		return
+	}
+	s.finish(input.StateToken)
+	if s.Scenario == Denied {
+		writeError(w, version, http.StatusUnauthorized, "Authentication denied on OL Protect")
+		return
+	}
+	s.writeSAML(w, version)
+}
+
+func (s *Server) finish(stateToken string) {
+	s.mu.Lock()
+	delete(s.states, stateToken)
+	s.mu.Unlock()
+}
+
+func (s *Server) writeSAML(w http.ResponseWriter, version int) {
+	response, err := s.signedResponse(time.Now().UTC())
+	if err != nil {
+		writeError(w, version, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if version == 2 {
+		writeJSON(w, http.StatusOK, &responseV2{Data: response, Message: "Success"})
+		return
+	}
+	writeJSON(w, http.StatusOK, &samlResponse{
+		Status: status{Type: "success", Message: "Success", Code: http.StatusOK},
+		Data:   response,
+	})
+}
+
+// writeError writes the error in the shape of the version of SAML assertion API
+func writeError(w http.ResponseWriter, version int, code int, message string) {
+	if version == 2 {
+		writeJSON(w, code, &errorResponseV2{StatusCode: code, Name: http.StatusText(code), Message: message})
+		return
+	}
+	writeStatus(w, code, message)
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, &statusResponse{
+		Status: status{Type: http.StatusText(code), Message: message, Error: true, Code: code},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,355 @@
+package mockserver
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/samlassertion"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/tokens"
+)
+
+func start(t *testing.T, scenario Scenario) (*Server, *httptest.Server, *samlassertion.SAMLAssertion) {
+	server, err := New(scenario)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	ts := httptest.NewServer(server)
+	config := onelogin.NewConfig(ts.URL, DefaultClientToken, DefaultClientSecret)
+	client := samlassertion.NewSAMLAssertion(config)
+	client.Poller = &samlassertion.Poller{
+		Interval: time.Millisecond,
+		Timeout:  10 * time.Second,
+	}
+	return server, ts, client
+}
+
+func generate(client *samlassertion.SAMLAssertion) (*samlassertion.GenerateResponse, error) {
+	return client.Generate(&samlassertion.GenerateRequest{
+		UsernameOrEmail: DefaultUsernameOrEmail,
+		Password:        DefaultPassword,
+		AppID:           "app-id",
+		Subdomain:       "mock",
+	})
+}
+
+func newSTS(t *testing.T, url string, creds *credentials.Credentials) *sts.STS {
+	s, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(url + "/sts"),
+		Region:      aws.String("us-east-1"),
+		Credentials: creds,
+	})
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	return sts.New(s)
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("unknown"); err == nil {
+		t.Error("It need to return unsupported scenario error.")
+	}
+}
+
+func TestServer_NoMFA(t *testing.T) {
+	_, ts, client := start(t, NoMFA)
+	defer ts.Close()
+	output, err := generate(client)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	roles, err := saml.ParseRoles(output.SAML)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if len(roles) != len(DefaultRoles) || roles[0] != DefaultRoles[0] {
+		t.Errorf("%v is not equal %v", roles, DefaultRoles)
+	}
+
+	client2 := newSTS(t, ts.URL, credentials.AnonymousCredentials)
+	assumed, err := client2.AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+		PrincipalArn:  aws.String(DefaultRoles[1].PrincipalArn),
+		RoleArn:       aws.String(DefaultRoles[1].RoleArn),
+		SAMLAssertion: aws.String(output.SAML),
+	})
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if !strings.HasPrefix(*assumed.Credentials.AccessKeyId, "ASIA") {
+		t.Errorf("%s is not temporary access key", *assumed.Credentials.AccessKeyId)
+	}
+	want := "arn:aws:sts::123456789012:assumed-role/ReadOnly/" + DefaultUsernameOrEmail
+	if *assumed.AssumedRoleUser.Arn != want {
+		t.Errorf("%s is not equal %s", *assumed.AssumedRoleUser.Arn, want)
+	}
+
+	// the chained role is assumed with the credentials issued by the fake STS
+	chained := newSTS(t, ts.URL, credentials.NewStaticCredentials(*assumed.Credentials.AccessKeyId, *assumed.Credentials.SecretAccessKey, *assumed.Credentials.SessionToken))
+	if _, err := chained.AssumeRole(&sts.AssumeRoleInput{
+		RoleArn:         aws.String("arn:aws:iam::210987654321:role/Chained"),
+		RoleSessionName: aws.String("session"),
+	}); err != nil {
+		t.Errorf("%#v", err)
+	}
+	identity, err := chained.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if *identity.Arn != want || *identity.Account != "123456789012" {
+		t.Errorf("%s is not equal %s", *identity.Arn, want)
+	}
+	unknown := newSTS(t, ts.URL, credentials.NewStaticCredentials("AKIAUNKNOWN", "secret", ""))
+	if _, err := unknown.AssumeRole(&sts.AssumeRoleInput{
+		RoleArn:         aws.String("arn:aws:iam::210987654321:role/Chained"),
+		RoleSessionName: aws.String("session"),
+	}); err == nil {
+		t.Error("It need to return invalid client token error.")
+	}
+}
+
+func TestServer_STSRejectsSAML(t *testing.T) {
+	_, ts, client := start(t, NoMFA)
+	defer ts.Close()
+	output, err := generate(client)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(output.SAML)
+	tampered := base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(data), "role/ReadOnly", "role/Root", 1)))
+	other, otherTS, _ := start(t, NoMFA)
+	defer otherTS.Close()
+	otherSAML, err := other.signedResponse(time.Now().UTC())
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	tests := []struct {
+		name string
+		role saml.Role
+		saml string
+		code string
+	}{
+		{name: "tampered", role: saml.Role{RoleArn: "arn:aws:iam::123456789012:role/Root", PrincipalArn: DefaultRoles[0].PrincipalArn}, saml: tampered, code: "InvalidIdentityToken"},
+		{name: "other key", role: DefaultRoles[0], saml: otherSAML, code: "InvalidIdentityToken"},
+		{name: "other role", role: saml.Role{RoleArn: "arn:aws:iam::123456789012:role/Root", PrincipalArn: DefaultRoles[0].PrincipalArn}, saml: output.SAML, code: "AccessDenied"},
+	}
+	client2 := newSTS(t, ts.URL, credentials.AnonymousCredentials)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client2.AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+				PrincipalArn:  aws.String(tt.role.PrincipalArn),
+				RoleArn:       aws.String(tt.role.RoleArn),
+				SAMLAssertion: aws.String(tt.saml),
+			})
+			aerr, ok := err.(awserr.Error)
+			if !ok {
+				t.Fatalf("%#v is not AWS error", err)
+			}
+			if aerr.Code() != tt.code {
+				t.Errorf("%s is not equal %s", aerr.Code(), tt.code)
+			}
+		})
+	}
+}
+
+func TestServer_OTP(t *testing.T) {
+	_, ts, client := start(t, OTP)
+	defer ts.Close()
+	output, err := generate(client)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if len(output.Factors) != 1 || len(output.Factors[0].Devices) != 1 {
+		t.Fatalf("%#v is not one factor with one device", output.Factors)
+	}
+	factor := output.Factors[0]
+	input := &samlassertion.VerifyFactorRequest{
+		AppID:       "app-id",
+		DeviceID:    "111111",
+		StateToken:  factor.StateToken,
+		OtpToken:    "000000",
+		DoNotNotify: true,
+		CallbackURL: factor.CallbackURL,
+	}
+	if _, err := client.VerifyFactor(input); err == nil {
+		t.Error("It need to return invalid OTP token error.")
+	}
+	input.OtpToken = DefaultOTPToken
+	verified, err := client.VerifyFactor(input)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if _, err := saml.ParseRoles(verified.SAML); err != nil {
+		t.Errorf("%#v", err)
+	}
+}
+
+func TestServer_Push(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		wantErr  error
+	}{
+		{scenario: Push},
+		{scenario: Denied, wantErr: samlassertion.ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			_, ts, client := start(t, tt.scenario)
+			defer ts.Close()
+			output, err := generate(client)
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			factor := output.Factors[0]
+			verified, err := client.VerifyFactor(&samlassertion.VerifyFactorRequest{
+				AppID:       "app-id",
+				DeviceID:    "222222",
+				StateToken:  factor.StateToken,
+				CallbackURL: factor.CallbackURL,
+			})
+			if err != tt.wantErr {
+				t.Fatalf("%v is not equal %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && verified.SAML == "" {
+				t.Error("SAML response is empty")
+			}
+		})
+	}
+}
+
+func TestServer_V2WithPrefix(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		wantErr  error
+	}{
+		{scenario: Push},
+		{scenario: Denied, wantErr: samlassertion.ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			server, err := New(tt.scenario)
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			server.Prefix = "/onelogin"
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+			// the routes are not served outside the prefix
+			if _, err := generate(samlassertion.NewSAMLAssertion(onelogin.NewConfig(ts.URL, DefaultClientToken, DefaultClientSecret))); err == nil {
+				t.Error("It need to return not found error.")
+			}
+			client := samlassertion.NewSAMLAssertionV2(onelogin.NewConfig(ts.URL+"/onelogin", DefaultClientToken, DefaultClientSecret))
+			client.Poller = &samlassertion.Poller{
+				Interval: time.Millisecond,
+				Timeout:  10 * time.Second,
+			}
+			output, err := client.Generate(&samlassertion.GenerateRequest{
+				UsernameOrEmail: DefaultUsernameOrEmail,
+				Password:        DefaultPassword,
+				AppID:           "app-id",
+				Subdomain:       "mock",
+			})
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+			factor := output.Factors[0]
+			if factor.CallbackURL != ts.URL+"/onelogin/api/2/saml_assertion/verify_factor" {
+				t.Errorf("%s is not the callback URL under the prefix", factor.CallbackURL)
+			}
+			verified, err := client.VerifyFactor(&samlassertion.VerifyFactorRequest{
+				AppID:       "app-id",
+				DeviceID:    "222222",
+				StateToken:  factor.StateToken,
+				CallbackURL: factor.CallbackURL,
+			})
+			if err != tt.wantErr {
+				t.Fatalf("%v is not equal %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if _, err := saml.ParseRoles(verified.SAML); err != nil {
+					t.Errorf("%#v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		want     string
+	}{
+		{scenario: RateLimit, want: "[429] Too Many Requests: Rate limit exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			_, ts, client := start(t, tt.scenario)
+			defer ts.Close()
+			_, err := generate(client)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("%v is not equal %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_ExpiredToken(t *testing.T) {
+	server, ts, client := start(t, ExpiredToken)
+	defer ts.Close()
+	if _, err := generate(client); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	// the expired access token is refreshed, and new tokens are generated after the refresh is rejected
+	if _, err := generate(client); err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if !server.revoked {
+		t.Error("the refresh is not rejected")
+	}
+}
+
+func TestServer_Tokens(t *testing.T) {
+	server, err := New(NoMFA)
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := tokens.NewTokens()
+	client.Endpoint = ts.URL
+	client.ClientToken = DefaultClientToken
+	client.ClientSecret = "invalid"
+	if _, err := client.Generate(); err == nil {
+		t.Error("It need to return authentication error.")
+	}
+	client.ClientSecret = DefaultClientSecret
+	generated, err := client.Generate()
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	refreshed, err := client.Refresh(&tokens.RefreshRequest{
+		AccessToken:  generated.AccessToken,
+		RefreshToken: generated.RefreshToken,
+	})
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if refreshed.AccessToken == generated.AccessToken {
+		t.Error("access token is not refreshed")
+	}
+	if _, err := client.Refresh(&tokens.RefreshRequest{
+		AccessToken:  generated.AccessToken,
+		RefreshToken: generated.RefreshToken,
+	}); err == nil {
+		t.Error("It need to return used refresh token error.")
+	}
+}
@@ -0,0 +1,198 @@
+package mockserver
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/aws/saml"
+)
+
+const (
+	namespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	namespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	namespaceDSig      = "http://www.w3.org/2000/09/xmldsig#"
+	algorithmC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algorithmEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algorithmRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algorithmSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	awsRecipient       = "https://signin.aws.amazon.com/saml"
+	awsAudience        = "urn:amazon:webservices"
+	timeFormat         = "2006-01-02T15:04:05Z"
+)
+
+// RoleSessionNameAttributeName is the SAML attribute of the role session name
+const RoleSessionNameAttributeName = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+
+type attr struct {
+	name  string
+	value string
+}
+
+// element renders the element in the exclusive canonical form,
+// in which the namespace declarations come first and the attributes are sorted by the name.
+// The children are already rendered.
+func element(name string, attrs []attr, children ...string) string {
+	sorted := append([]attr{}, attrs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, nj := strings.HasPrefix(sorted[i].name, "xmlns"), strings.HasPrefix(sorted[j].name, "xmlns")
+		if ni != nj {
+			return ni
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, a := range sorted {
+		b.WriteString(" " + a.name + `="` + attrReplacer.Replace(a.value) + `"`)
+	}
+	b.WriteString(">")
+	for _, child := range children {
+		b.WriteString(child)
+	}
+	b.WriteString("</" + name + ">")
+	return b.String()
+}
+
+var textReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func text(value string) string {
+	return textReplacer.Replace(value)
+}
+
+// signedInfo renders SignedInfo of the digest, which is signed with the namespace declaration
+func signedInfo(id string, digest string, attrs ...attr) string {
+	return element("ds:SignedInfo", attrs,
+		element("ds:CanonicalizationMethod", []attr{{"Algorithm", algorithmC14N}}),
+		element("ds:SignatureMethod", []attr{{"Algorithm", algorithmRSASHA256}}),
+		element("ds:Reference", []attr{{"URI", "#" + id}},
+			element("ds:Transforms", nil,
+				element("ds:Transform", []attr{{"Algorithm", algorithmEnveloped}}),
+				element("ds:Transform", []attr{{"Algorithm", algorithmC14N}}),
+			),
+			element("ds:DigestMethod", []attr{{"Algorithm", algorithmSHA256}}),
+			element("ds:DigestValue", nil, digest),
+		),
+	)
+}
+
+// signedResponse returns the base64 encoded SAML response with the assertion signed by the key of the server
+func (s *Server) signedResponse(now time.Time) (string, error) {
+	id := "_" + randomHex(20)
+	issuer := element("saml:Issuer", nil, text(s.Issuer))
+	roles := []string{}
+	for _, role := range s.Roles {
+		roles = append(roles, element("saml:AttributeValue", nil, text(role.RoleArn+","+role.PrincipalArn)))
+	}
+	statements := element("saml:Subject", nil,
+		element("saml:NameID", []attr{{"Format", "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"}}, text(s.UsernameOrEmail)),
+		element("saml:SubjectConfirmation", []attr{{"Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer"}},
+			element("saml:SubjectConfirmationData", []attr{
+				{"NotOnOrAfter", now.Add(5 * time.Minute).Format(timeFormat)},
+				{"Recipient", awsRecipient},
+			}),
+		),
+	) + element("saml:Conditions", []attr{
+		{"NotBefore", now.Add(-time.Minute).Format(timeFormat)},
+		{"NotOnOrAfter", now.Add(5 * time.Minute).Format(timeFormat)},
+	},
+		element("saml:AudienceRestriction", nil, element("saml:Audience", nil, awsAudience)),
+	) + element("saml:AuthnStatement", []attr{{"AuthnInstant", now.Format(timeFormat)}, {"SessionIndex", id}},
+		element("saml:AuthnContext", nil,
+			element("saml:AuthnContextClassRef", nil, "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"),
+		),
+	) + element("saml:AttributeStatement", nil,
+		element("saml:Attribute", []attr{{"Name", RoleSessionNameAttributeName}},
+			element("saml:AttributeValue", nil, text(s.UsernameOrEmail)),
+		),
+		element("saml:Attribute", []attr{{"Name", saml.RoleAttributeName}}, roles...),
+	)
+	assertionAttrs := []attr{{"xmlns:saml", namespaceAssertion}, {"ID", id}, {"IssueInstant", now.Format(timeFormat)}, {"Version", "2.0"}}
+
+	// the enveloped signature is removed from the assertion before the digest
+	digest := sha256.Sum256([]byte(element("saml:Assertion", assertionAttrs, issuer, statements)))
+	digestValue := base64.StdEncoding.EncodeToString(digest[:])
+	hashed := sha256.Sum256([]byte(signedInfo(id, digestValue, attr{"xmlns:ds", namespaceDSig})))
+	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	signature := element("ds:Signature", []attr{{"xmlns:ds", namespaceDSig}},
+		signedInfo(id, digestValue),
+		element("ds:SignatureValue", nil, base64.StdEncoding.EncodeToString(signatureValue)),
+		element("ds:KeyInfo", nil,
+			element("ds:X509Data", nil,
+				element("ds:X509Certificate", nil, base64.StdEncoding.EncodeToString(s.certificate)),
+			),
+		),
+	)
+	assertion := element("saml:Assertion", assertionAttrs, issuer, signature, statements)
+	response := element("samlp:Response", []attr{
+		{"xmlns:samlp", namespaceProtocol},
+		{"xmlns:saml", namespaceAssertion},
+		{"Destination", awsRecipient},
+		{"ID", "_" + randomHex(20)},
+		{"IssueInstant", now.Format(timeFormat)},
+		{"Version", "2.0"},
+	},
+		issuer,
+		element("samlp:Status", nil, element("samlp:StatusCode", []attr{{"Value", "urn:oasis:names:tc:SAML:2.0:status:Success"}})),
+		assertion,
+	)
+	return base64.StdEncoding.EncodeToString([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + response)), nil
+}
+
+// verifySAML verifies the signature of the SAML response issued by the server, and returns the AWS roles in it
+func (s *Server) verifySAML(response string) ([]saml.Role, error) {
+	data, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return nil, errors.Wrap(err, "SAML response is not base64 encoded")
+	}
+	assertion, ok := between(string(data), "<saml:Assertion ", "</saml:Assertion>")
+	if !ok {
+		return nil, errors.New("SAML assertion is not exists")
+	}
+	signature, ok := between(assertion, "<ds:Signature ", "</ds:Signature>")
+	if !ok {
+		return nil, errors.New("SAML assertion is not signed")
+	}
+	info, _ := between(signature, "<ds:SignedInfo>", "</ds:SignedInfo>")
+	digestValue, _ := between(info, "<ds:DigestValue>", "</ds:DigestValue>")
+	signatureValue, _ := between(signature, "<ds:SignatureValue>", "</ds:SignatureValue>")
+	digest := sha256.Sum256([]byte(strings.Replace(assertion, signature, "", 1)))
+	if digestValue != "<ds:DigestValue>"+base64.StdEncoding.EncodeToString(digest[:])+"</ds:DigestValue>" {
+		return nil, errors.New("digest of SAML assertion is not valid")
+	}
+	value, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(signatureValue, "<ds:SignatureValue>"), "</ds:SignatureValue>"))
+	if err != nil {
+		return nil, errors.Wrap(err, "signature of SAML assertion is not base64 encoded")
+	}
+	canonical := `<ds:SignedInfo xmlns:ds="` + namespaceDSig + `">` + strings.TrimPrefix(info, "<ds:SignedInfo>")
+	hashed := sha256.Sum256([]byte(canonical))
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, hashed[:], value); err != nil {
+		return nil, errors.New("signature of SAML assertion is not valid")
+	}
+	return saml.ParseRoles(response)
+}
+
+// between returns the first part of the value starting with start and ending with end
+func between(value string, start string, end string) (string, bool) {
+	i := strings.Index(value, start)
+	if i < 0 {
+		return "", false
+	}
+	j := strings.Index(value[i:], end)
+	if j < 0 {
+		return "", false
+	}
+	return value[i : i+j+len(end)], true
+}
@@ -0,0 +1,176 @@
+package mockserver
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type stsCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+type assumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+type assumeRoleResult struct {
+	Credentials     stsCredentials  `xml:"Credentials"`
+	AssumedRoleUser assumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+type assumeRoleWithSAMLResponse struct {
+	XMLName   xml.Name         `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleWithSAMLResponse"`
+	Result    assumeRoleResult `xml:"AssumeRoleWithSAMLResult"`
+	RequestID string           `xml:"ResponseMetadata>RequestId"`
+}
+
+type assumeRoleResponse struct {
+	XMLName   xml.Name         `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse"`
+	Result    assumeRoleResult `xml:"AssumeRoleResult"`
+	RequestID string           `xml:"ResponseMetadata>RequestId"`
+}
+
+type getCallerIdentityResponse struct {
+	XMLName   xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetCallerIdentityResponse"`
+	Arn       string   `xml:"GetCallerIdentityResult>Arn"`
+	UserID    string   `xml:"GetCallerIdentityResult>UserId"`
+	Account   string   `xml:"GetCallerIdentityResult>Account"`
+	RequestID string   `xml:"ResponseMetadata>RequestId"`
+}
+
+type stsErrorResponse struct {
+	XMLName   xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// sts fakes AssumeRoleWithSAML with the SAML responses issued by the server,
+// and AssumeRole and GetCallerIdentity with the credentials issued by the server
+func (s *Server) sts(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeSTSError(w, http.StatusBadRequest, "InvalidParameterValue", err.Error())
+		return
+	}
+	duration := int64(3600)
+	if value := r.PostForm.Get("DurationSeconds"); value != "" {
+		var err error
+		if duration, err = strconv.ParseInt(value, 10, 64); err != nil || duration < 900 || duration > 43200 {
+			writeSTSError(w, http.StatusBadRequest, "ValidationError", "DurationSeconds must be between 900 and 43200")
+			return
+		}
+	}
+	roleArn := r.PostForm.Get("RoleArn")
+	switch r.PostForm.Get("Action") {
+	case "AssumeRoleWithSAML":
+		roles, err := s.verifySAML(r.PostForm.Get("SAMLAssertion"))
+		if err != nil {
+			writeSTSError(w, http.StatusBadRequest, "InvalidIdentityToken", err.Error())
+			return
+		}
+		allowed := false
+		for _, role := range roles {
+			allowed = allowed || (role.RoleArn == roleArn && role.PrincipalArn == r.PostForm.Get("PrincipalArn"))
+		}
+		if !allowed {
+			writeSTSError(w, http.StatusForbidden, "AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML")
+			return
+		}
+		writeXML(w, http.StatusOK, &assumeRoleWithSAMLResponse{
+			Result:    s.assumeRole(roleArn, s.UsernameOrEmail, duration),
+			RequestID: randomHex(16),
+		})
+	case "AssumeRole":
+		if _, ok := s.issued(r.Header.Get("Authorization")); !ok {
+			writeSTSError(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid")
+			return
+		}
+		sessionName := r.PostForm.Get("RoleSessionName")
+		if !strings.Contains(roleArn, ":role/") || sessionName == "" {
+			writeSTSError(w, http.StatusBadRequest, "ValidationError", "RoleArn and RoleSessionName are required")
+			return
+		}
+		writeXML(w, http.StatusOK, &assumeRoleResponse{
+			Result:    s.assumeRole(roleArn, sessionName, duration),
+			RequestID: randomHex(16),
+		})
+	case "GetCallerIdentity":
+		user, ok := s.issued(r.Header.Get("Authorization"))
+		if !ok {
+			writeSTSError(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid")
+			return
+		}
+		writeXML(w, http.StatusOK, &getCallerIdentityResponse{
+			Arn:       user.Arn,
+			UserID:    user.AssumedRoleID,
+			Account:   strings.Split(user.Arn, ":")[4],
+			RequestID: randomHex(16),
+		})
+	default:
+		writeSTSError(w, http.StatusBadRequest, "InvalidAction", r.PostForm.Get("Action")+" is not supported")
+	}
+}
+
+// assumeRole issues the credentials of the role
+func (s *Server) assumeRole(roleArn string, sessionName string, duration int64) assumeRoleResult {
+	accessKeyID := "ASIA" + strings.ToUpper(randomHex(8))
+	account := ""
+	if parts := strings.Split(roleArn, ":"); len(parts) > 4 {
+		account = parts[4]
+	}
+	roleName := roleArn[strings.LastIndex(roleArn, "/")+1:]
+	roleID := "AROA" + strings.ToUpper(randomHex(8))
+	user := assumedRoleUser{
+		Arn:           "arn:aws:sts::" + account + ":assumed-role/" + roleName + "/" + sessionName,
+		AssumedRoleID: roleID + ":" + sessionName,
+	}
+	s.mu.Lock()
+	s.accessKeys[accessKeyID] = user
+	s.mu.Unlock()
+	return assumeRoleResult{
+		Credentials: stsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: randomHex(20),
+			SessionToken:    randomHex(64),
+			Expiration:      time.Now().UTC().Add(time.Duration(duration) * time.Second).Format(timeFormat),
+		},
+		AssumedRoleUser: user,
+	}
+}
+
+// issued returns the user assumed by the access key signing the request if it is issued by the server
+func (s *Server) issued(authorization string) (assumedRoleUser, bool) {
+	i := strings.Index(authorization, "Credential=")
+	if i < 0 {
+		return assumedRoleUser{}, false
+	}
+	accessKeyID := strings.SplitN(authorization[i+len("Credential="):], "/", 2)[0]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.accessKeys[accessKeyID]
+	return user, ok
+}
+
+func writeSTSError(w http.ResponseWriter, code int, errorCode string, message string) {
+	writeXML(w, code, &stsErrorResponse{
+		Type:      "Sender",
+		Code:      errorCode,
+		Message:   message,
+		RequestID: randomHex(16),
+	})
+}
+
+func writeXML(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
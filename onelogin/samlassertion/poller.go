@@ -0,0 +1,138 @@
+package samlassertion
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+)
+
+// DefaultApprovalTimeout is the default deadline of the push notification approval
+const DefaultApprovalTimeout = 60 * time.Second
+
+// ErrDenied is returned when the push notification is denied on the device
+var ErrDenied = errors.New("push notification is denied")
+
+// ErrTimedOut is returned when the push notification is not approved until the deadline
+var ErrTimedOut = errors.New("push notification is not approved in time")
+
+// Poller decides the intervals of polling the pending push notification
+type Poller struct {
+	// Interval is the interval before the first poll
+	Interval time.Duration
+	// MaxInterval caps the interval growing by Multiplier
+	MaxInterval time.Duration
+	Multiplier  float64
+	// Jitter randomizes the interval by the fraction not to poll in lockstep
+	Jitter float64
+	// Timeout is the deadline of the approval from the push notification
+	Timeout time.Duration
+	random  func() float64
+}
+
+// NewPoller creates a Poller with the default intervals
+func NewPoller() *Poller {
+	return &Poller{
+		Interval:    time.Second,
+		MaxInterval: 5 * time.Second,
+		Multiplier:  1.5,
+		Jitter:      0.2,
+		Timeout:     DefaultApprovalTimeout,
+		random:      rand.Float64,
+	}
+}
+
+// Backoff returns the interval before the poll of the attempt counted from zero
+func (p *Poller) Backoff(attempt int) time.Duration {
+	interval := float64(p.Interval)
+	for i := 0; i < attempt && p.Multiplier > 1; i++ {
+		interval *= p.Multiplier
+		if p.MaxInterval > 0 && interval >= float64(p.MaxInterval) {
+			interval = float64(p.MaxInterval)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		random := p.random
+		if random == nil {
+			random = rand.Float64
+		}
+		interval *= 1 + p.Jitter*(2*random()-1)
+	}
+	return time.Duration(interval)
+}
+
+// verifyWithPoller verifies the factor, and polls it while the push notification is pending
+func verifyWithPoller(ctx context.Context, poller *Poller, input *VerifyFactorRequest, verify func(context.Context, *VerifyFactorRequest) (*VerifyFactorResponse, error)) (*VerifyFactorResponse, error) {
+	if poller == nil {
+		poller = NewPoller()
+	}
+	deadline := time.Now().Add(poller.Timeout)
+	output, err := verify(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if output.Status.Error {
+		return nil, statusError(output.Status)
+	}
+	if output.Status.Type != "pending" {
+		return output, nil
+	}
+	pollCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	next := *input
+	next.DoNotNotify = true
+	for attempt := 0; ; attempt++ {
+		timer := time.NewTimer(poller.Backoff(attempt))
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			return nil, pollError(ctx, pollCtx.Err())
+		case <-timer.C:
+		}
+		output, err := verify(pollCtx, &next)
+		if err != nil {
+			return nil, pollError(ctx, err)
+		}
+		if output.Status.Error {
+			if isDenied(output.Status) {
+				return nil, ErrDenied
+			}
+			return nil, statusError(output.Status)
+		}
+		if output.Status.Type != "pending" {
+			return output, nil
+		}
+		logging.Debug("push notification is pending", logging.F("attempt", attempt+1))
+	}
+}
+
+// pollError tells the deadline of the poller from the cancel of the caller
+func pollError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == context.DeadlineExceeded {
+		return ErrTimedOut
+	}
+	return err
+}
+
+// isDenied tells the denial of the push notification from the other 401 responses,
+// such as the expired or invalid access token which is reported as the status error.
+func isDenied(status *VerifyFactorResponseStatus) bool {
+	if status.Code != http.StatusUnauthorized {
+		return false
+	}
+	message := strings.ToLower(status.Message)
+	return strings.Contains(message, "denied") || message == "authentication failed"
+}
+
+func statusError(status *VerifyFactorResponseStatus) error {
+	return errors.Errorf("[%d] %s: %s", status.Code, status.Type, status.Message)
+}
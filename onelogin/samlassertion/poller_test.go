@@ -0,0 +1,200 @@
+package samlassertion
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/credentials"
+)
+
+func TestPoller_Backoff(t *testing.T) {
+	p := &Poller{
+		Interval:    time.Second,
+		MaxInterval: 5 * time.Second,
+		Multiplier:  2,
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, w := range want {
+		if got := p.Backoff(attempt); got != w {
+			t.Errorf("Backoff(%d) %v is not equal %v", attempt, got, w)
+		}
+	}
+	p.Jitter = 0.5
+	p.random = func() float64 { return 0 }
+	if got := p.Backoff(1); got != time.Second {
+		t.Errorf("%v is not equal %v", got, time.Second)
+	}
+	p.random = func() float64 { return 1 }
+	if got := p.Backoff(1); got != 3*time.Second {
+		t.Errorf("%v is not equal %v", got, 3*time.Second)
+	}
+	p = NewPoller()
+	for attempt := 0; attempt < 10; attempt++ {
+		got := p.Backoff(attempt)
+		if got < 800*time.Millisecond || got > 6*time.Second {
+			t.Errorf("Backoff(%d) %v is out of the jitter", attempt, got)
+		}
+	}
+}
+
+// pushServer is a fake of Verify Factor API answering the statuses in order
+type pushServer struct {
+	mu       sync.Mutex
+	statuses []string
+	requests []*VerifyFactorRequest
+	paths    []string
+}
+
+func (p *pushServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	var input VerifyFactorRequest
+	json.Unmarshal(body, &input)
+	p.requests = append(p.requests, &input)
+	p.paths = append(p.paths, r.URL.Path)
+	status := p.statuses[0]
+	if len(p.statuses) > 1 {
+		p.statuses = p.statuses[1:]
+	}
+	switch status {
+	case "pending":
+		fmt.Fprint(w, `{"status": {"type": "pending", "message": "Authentication pending on OL Protect", "error": false, "code": 200}}`)
+	case "denied":
+		fmt.Fprint(w, `{"status": {"type": "Unauthorized", "message": "Authentication Failed", "error": true, "code": 401}}`)
+	case "expired":
+		fmt.Fprint(w, `{"status": {"type": "Unauthorized", "message": "Access Token has expired", "error": true, "code": 401}}`)
+	case "error":
+		fmt.Fprint(w, `{"status": {"type": "bad request", "message": "Invalid state token", "error": true, "code": 400}}`)
+	default:
+		fmt.Fprint(w, bytes.NewBufferString(`{"status": {"type": "success", "message": "Success", "error": false, "code": 200}, "data": "Base64 Encoded SAML Data"}`))
+	}
+}
+
+func newPushAssertion(statuses ...string) (*SAMLAssertion, *pushServer, func()) {
+	push := &pushServer{statuses: statuses}
+	ts := httptest.NewTLSServer(push)
+	u, _ := url.Parse(ts.URL)
+	s := &SAMLAssertion{
+		config: &onelogin.Config{
+			Endpoint: u.Host,
+			Credentials: credentials.New(nil, &credentials.Value{
+				AccessToken:      "access-token",
+				AccessExpiresAt:  time.Now().Add(time.Minute),
+				RefreshExpiresAt: time.Now().Add(time.Minute),
+			}),
+		},
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		Poller: &Poller{
+			Interval:    time.Millisecond,
+			MaxInterval: 5 * time.Millisecond,
+			Multiplier:  2,
+			Jitter:      0.2,
+			Timeout:     time.Second,
+		},
+	}
+	return s, push, ts.Close
+}
+
+func TestSAMLAssertion_VerifyFactorPollApproved(t *testing.T) {
+	s, push, close := newPushAssertion("pending", "pending", "pending", "success")
+	defer close()
+	callback := fmt.Sprintf("https://%s/api/1/saml_assertion/verify_factor/callback", s.config.Endpoint)
+	got, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{
+		AppID:       "app-id",
+		DeviceID:    "device-id",
+		StateToken:  "state-token",
+		CallbackURL: callback,
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if got == nil || got.SAML != "Base64 Encoded SAML Data" {
+		t.Errorf("%+v is not approved", got)
+	}
+	if len(push.requests) != 4 {
+		t.Errorf("%d is not equal %d", len(push.requests), 4)
+	}
+	for i, request := range push.requests {
+		if request.DoNotNotify != (i > 0) {
+			t.Errorf("DoNotNotify of the request %d is %v", i, request.DoNotNotify)
+		}
+		if push.paths[i] != "/api/1/saml_assertion/verify_factor/callback" {
+			t.Errorf("%s is not the callback URL", push.paths[i])
+		}
+	}
+}
+
+func TestSAMLAssertion_VerifyFactorPollDenied(t *testing.T) {
+	s, push, close := newPushAssertion("pending", "pending", "denied")
+	defer close()
+	_, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"})
+	if err != ErrDenied {
+		t.Errorf("%v is not equal %v", err, ErrDenied)
+	}
+	if len(push.requests) != 3 {
+		t.Errorf("%d is not equal %d", len(push.requests), 3)
+	}
+}
+
+func TestSAMLAssertion_VerifyFactorPollTimedOut(t *testing.T) {
+	s, _, close := newPushAssertion("pending")
+	defer close()
+	s.Poller.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"})
+	if err != ErrTimedOut {
+		t.Errorf("%v is not equal %v", err, ErrTimedOut)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("It need to stop polling at the deadline.")
+	}
+}
+
+func TestSAMLAssertion_VerifyFactorPollError(t *testing.T) {
+	s, _, close := newPushAssertion("pending", "error")
+	defer close()
+	_, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"})
+	if err == nil || err == ErrDenied || err == ErrTimedOut {
+		t.Errorf("%v is not the status error", err)
+	}
+}
+
+func TestSAMLAssertion_VerifyFactorPollTokenExpired(t *testing.T) {
+	s, _, close := newPushAssertion("pending", "expired")
+	defer close()
+	_, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"})
+	if err == nil || err == ErrDenied || err == ErrTimedOut {
+		t.Errorf("%v is not the status error", err)
+	}
+}
+
+func TestSAMLAssertion_VerifyFactorOtherCallbackHost(t *testing.T) {
+	s, push, close := newPushAssertion("success")
+	defer close()
+	_, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{
+		AppID:       "app-id",
+		CallbackURL: "https://example.com/api/1/saml_assertion/verify_factor/callback",
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if len(push.paths) != 1 || push.paths[0] != "/api/1/saml_assertion/verify_factor" {
+		t.Errorf("%v is not Verify Factor API", push.paths)
+	}
+}
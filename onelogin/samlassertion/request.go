@@ -0,0 +1,46 @@
+package samlassertion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/endpoint"
+)
+
+// post requests OneLogin API with the access token formatted in the Authorization header,
+// and returns the HTTP status code and the body
+func post(ctx context.Context, client *http.Client, config *onelogin.Config, url string, authorization string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	credentials, err := config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(authorization, credentials.AccessToken))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, data, err
+}
+
+// verifyFactorURL returns the callback URL if it is on the endpoint not to send the access token to other hosts,
+// or the URL of the path on the endpoint
+func verifyFactorURL(config *onelogin.Config, callback string, path string) string {
+	if endpoint.Contains(config.Endpoint, callback) {
+		return callback
+	}
+	return endpoint.URL(config.Endpoint, path)
+}
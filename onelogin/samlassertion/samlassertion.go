@@ -1,24 +1,25 @@
 package samlassertion
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/endpoint"
 )
 
+// NotifyDeviceType is the device type to send a push notification to OneLogin Protect
+const NotifyDeviceType = "Notify to OneLogin Protect"
+
 // SAMLAssertion OneLogin Generate SAML Assertion API
 type SAMLAssertion struct {
-	config                   *onelogin.Config
-	HTTPClient               *http.Client
-	verifyFactorLoopMax      int
-	verifyFactorLoopDuration int
+	config     *onelogin.Config
+	HTTPClient *http.Client
+	// Poller polls the pending push notification until it is approved
+	Poller *Poller
 }
 
 // https://developers.onelogin.com/api-docs/1/saml-assertions/generate-saml-assertion
@@ -89,6 +90,8 @@ type VerifyFactorRequest struct {
 	StateToken  string `json:"state_token"`
 	OtpToken    string `json:"otp_token"`
 	DoNotNotify bool   `json:"do_not_notify"`
+	// CallbackURL is the callback_url of the factor to verify, which is used instead of Verify Factor API
+	CallbackURL string `json:"-"`
 }
 
 // VerifyFactorTemporaryResponse response of OneLogin VerifyFactor Tokens v2 API
@@ -105,23 +108,34 @@ type VerifyFactorResponseStatus struct {
 	Code    int    `json:"code"`
 }
 
+// authorizationV1 is the Authorization header of API v1
+const authorizationV1 = "bearer:%s"
+
 // NewSAMLAssertion creates a SAMLAssertion
 func NewSAMLAssertion(config *onelogin.Config) *SAMLAssertion {
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
 	return &SAMLAssertion{
-		config:                   config,
-		HTTPClient:               &http.Client{},
-		verifyFactorLoopMax:      60,
-		verifyFactorLoopDuration: 1000,
+		config:     config,
+		HTTPClient: client,
+		Poller:     NewPoller(),
 	}
 }
 
 // Generate call generate tokens v2
 func (s *SAMLAssertion) Generate(input *GenerateRequest) (*GenerateResponse, error) {
+	return s.GenerateWithContext(context.Background(), input)
+}
+
+// GenerateWithContext is Generate canceled with the context
+func (s *SAMLAssertion) GenerateWithContext(ctx context.Context, input *GenerateRequest) (*GenerateResponse, error) {
 	inputJSON, err := json.Marshal(input)
 	if err != nil {
 		return nil, err
 	}
-	body, err := s.post("/api/1/saml_assertion", inputJSON)
+	body, err := s.post(ctx, "/api/1/saml_assertion", inputJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -143,19 +157,7 @@ func (s *SAMLAssertion) Generate(input *GenerateRequest) (*GenerateResponse, err
 		if err := json.Unmarshal(body, &factors); err != nil {
 			return nil, err
 		}
-		devices := factors.Factors[0].Devices
-		for i := range devices {
-			devices[i].RequireOTPToken = true
-			device := devices[i]
-			if device.DeviceType == "OneLogin Protect" {
-				devices = append(devices, GenerateResponseFactorDevice{
-					DeviceType:      "Notify to OneLogin Protect",
-					DeviceID:        device.DeviceID,
-					RequireOTPToken: false,
-				})
-			}
-		}
-		factors.Factors[0].Devices = devices
+		factors.Factors[0].Devices = withNotifyDevices(factors.Factors[0].Devices)
 		output.Factors = factors.Factors
 	}
 	return &output, nil
@@ -163,15 +165,40 @@ func (s *SAMLAssertion) Generate(input *GenerateRequest) (*GenerateResponse, err
 
 // VerifyFactor call VerifyFactor tokens v2
 func (s *SAMLAssertion) VerifyFactor(input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
-	return s.verifyFactor(input, 0)
+	return s.VerifyFactorWithContext(context.Background(), input)
+}
+
+// VerifyFactorWithContext is VerifyFactor canceled with the context.
+// The pending push notification is polled until it is approved, and ErrDenied or ErrTimedOut
+// is returned if it is denied or it is not approved until the deadline of the Poller.
+func (s *SAMLAssertion) VerifyFactorWithContext(ctx context.Context, input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
+	return verifyWithPoller(ctx, s.Poller, input, s.verifyFactor)
+}
+
+// withNotifyDevices marks the devices requiring the MFA token,
+// and adds the device sending the push notification for OneLogin Protect
+func withNotifyDevices(devices []GenerateResponseFactorDevice) []GenerateResponseFactorDevice {
+	for i := range devices {
+		devices[i].RequireOTPToken = true
+		device := devices[i]
+		if device.DeviceType == "OneLogin Protect" {
+			devices = append(devices, GenerateResponseFactorDevice{
+				DeviceType:      NotifyDeviceType,
+				DeviceID:        device.DeviceID,
+				RequireOTPToken: false,
+			})
+		}
+	}
+	return devices
 }
 
-func (s *SAMLAssertion) verifyFactor(input *VerifyFactorRequest, loopCount int) (*VerifyFactorResponse, error) {
+// verifyFactor posts the request to the callback URL or Verify Factor API
+func (s *SAMLAssertion) verifyFactor(ctx context.Context, input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
 	inputJSON, err := json.Marshal(input)
 	if err != nil {
 		return nil, err
 	}
-	body, err := s.post("/api/1/saml_assertion/verify_factor", inputJSON)
+	_, body, err := post(ctx, s.HTTPClient, s.config, verifyFactorURL(s.config, input.CallbackURL, "/api/1/saml_assertion/verify_factor"), authorizationV1, inputJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -179,39 +206,14 @@ func (s *SAMLAssertion) verifyFactor(input *VerifyFactorRequest, loopCount int)
 	if err := json.Unmarshal(body, &output); err != nil {
 		return nil, err
 	}
-	if output.Status.Error {
-		return nil, errors.Errorf("[%d] %s: %s", output.Status.Code, output.Status.Type, output.Status.Message)
-	}
-	if output.Status.Type == "pending" {
-		if loopCount >= s.verifyFactorLoopMax {
-			return nil, errors.Errorf("[%d] timed out: %s", output.Status.Code, output.Status.Message)
-		}
-		time.Sleep(time.Duration(s.verifyFactorLoopDuration))
-		input.DoNotNotify = true
-		return s.verifyFactor(input, loopCount+1)
+	if output.Status == nil {
+		return nil, errors.Errorf("status is not exists in the response of verify factor")
 	}
 	return &output, nil
 }
 
 // post OneLogin API Request
-func (s *SAMLAssertion) post(path string, body []byte) ([]byte, error) {
-	url := fmt.Sprintf("https://%s%s", s.config.Endpoint, path)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-	credentials, err := s.config.Credentials.Get()
-	if err != nil {
-		return nil, err
-	}
-	authorization := fmt.Sprintf("bearer:%s", credentials.AccessToken)
-	req.Header.Set("Authorization", authorization)
-	req.Header.Set("Content-Type", "application/json")
-	client := s.HTTPClient
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+func (s *SAMLAssertion) post(ctx context.Context, path string, body []byte) ([]byte, error) {
+	_, res, err := post(ctx, s.HTTPClient, s.config, endpoint.URL(s.config.Endpoint, path), authorizationV1, body)
+	return res, err
 }
@@ -2,6 +2,7 @@ package samlassertion
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -520,10 +521,12 @@ func TestSAMLAssertion_VerifyFactor(t *testing.T) {
 			endpoint := fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
 			tt.fields.config.Endpoint = endpoint
 			s := &SAMLAssertion{
-				config:                   tt.fields.config,
-				HTTPClient:               httpClient,
-				verifyFactorLoopMax:      2,
-				verifyFactorLoopDuration: 100,
+				config:     tt.fields.config,
+				HTTPClient: httpClient,
+				Poller: &Poller{
+					Interval: time.Millisecond,
+					Timeout:  100 * time.Millisecond,
+				},
 			}
 			got, err := s.VerifyFactor(tt.args.input)
 			if (err != nil) != tt.wantErr {
@@ -535,3 +538,84 @@ func TestSAMLAssertion_VerifyFactor(t *testing.T) {
 		})
 	}
 }
+
+func TestSAMLAssertion_VerifyFactorWithContext(t *testing.T) {
+	config := &onelogin.Config{
+		ClientToken:  "client-token",
+		ClientSecret: "client-secret",
+		Credentials: credentials.New(nil, &credentials.Value{
+			AccessToken:      "access-token",
+			RefreshToken:     "refresh-token",
+			CreatedAt:        time.Now().UTC(),
+			AccessExpiresAt:  time.Now().UTC().Add(time.Minute),
+			RefreshExpiresAt: time.Now().UTC().Add(time.Minute),
+		}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requested := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		// the user presses Ctrl-C while the push notification is pending
+		cancel()
+		fmt.Fprintln(w, `{"status": {"message": "Authentication pending on OL Protect", "error": false, "type": "pending", "code": 200}}`)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	config.Endpoint = fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
+	s := &SAMLAssertion{
+		config: config,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		Poller: &Poller{
+			Interval: time.Hour,
+			Timeout:  time.Hour,
+		},
+	}
+	start := time.Now()
+	_, err := s.VerifyFactorWithContext(ctx, &VerifyFactorRequest{AppID: "app-id"})
+	if err != context.Canceled {
+		t.Errorf("%v is not equal %v", err, context.Canceled)
+	}
+	if requested != 1 {
+		t.Errorf("%d is not equal %d", requested, 1)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("It need to stop polling when the context is canceled.")
+	}
+}
+
+func TestSAMLAssertion_GenerateWithBaseURL(t *testing.T) {
+	var requested string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		fmt.Fprintln(w, `{"status": {"type": "success", "message": "Success", "error": false, "code": 200}, "data": "Base64 Encoded SAML Data"}`)
+	}))
+	defer ts.Close()
+	config := &onelogin.Config{
+		Endpoint:     ts.URL + "/onelogin/",
+		ClientToken:  "client-token",
+		ClientSecret: "client-secret",
+		Credentials: credentials.New(nil, &credentials.Value{
+			AccessToken:      "access-token",
+			RefreshToken:     "refresh-token",
+			CreatedAt:        time.Now().UTC(),
+			AccessExpiresAt:  time.Now().UTC().Add(time.Minute),
+			RefreshExpiresAt: time.Now().UTC().Add(time.Minute),
+		}),
+	}
+	s := NewSAMLAssertion(config)
+	got, err := s.Generate(&GenerateRequest{AppID: "app-id"})
+	if err != nil {
+		t.Fatalf("%#v", err)
+	}
+	if got.SAML != "Base64 Encoded SAML Data" {
+		t.Errorf("%s is not equal %s", got.SAML, "Base64 Encoded SAML Data")
+	}
+	if requested != "/onelogin/api/1/saml_assertion" {
+		t.Errorf("%s is not equal %s", requested, "/onelogin/api/1/saml_assertion")
+	}
+}
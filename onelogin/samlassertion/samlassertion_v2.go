@@ -0,0 +1,169 @@
+package samlassertion
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/endpoint"
+)
+
+// https://developers.onelogin.com/api-docs/2/saml-assertions/generate-saml-assertion
+// https://developers.onelogin.com/api-docs/2/saml-assertions/verify-factor
+
+// authorizationV2 is the Authorization header of API v2
+const authorizationV2 = "Bearer %s"
+
+// SAMLAssertionV2 OneLogin Generate SAML Assertion API v2.
+// The responses are converted into the same shape as API v1.
+type SAMLAssertionV2 struct {
+	config     *onelogin.Config
+	HTTPClient *http.Client
+	// Poller polls the pending push notification until it is approved
+	Poller *Poller
+}
+
+// responseV2 is the response of API v2 with or without MFA
+type responseV2 struct {
+	SAML        string                         `json:"data"`
+	Message     string                         `json:"message"`
+	StateToken  string                         `json:"state_token"`
+	Devices     []GenerateResponseFactorDevice `json:"devices"`
+	CallbackURL string                         `json:"callback_url"`
+	User        *GenerateResponseFactorUser    `json:"user"`
+}
+
+// errorResponseV2 is the response of API v2 with HTTP error status
+type errorResponseV2 struct {
+	StatusCode int    `json:"statusCode"`
+	Name       string `json:"name"`
+	Message    string `json:"message"`
+}
+
+// NewSAMLAssertionV2 creates a SAMLAssertionV2
+func NewSAMLAssertionV2(config *onelogin.Config) *SAMLAssertionV2 {
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &SAMLAssertionV2{
+		config:     config,
+		HTTPClient: client,
+		Poller:     NewPoller(),
+	}
+}
+
+// Generate call generate SAML assertion v2
+func (s *SAMLAssertionV2) Generate(input *GenerateRequest) (*GenerateResponse, error) {
+	return s.GenerateWithContext(context.Background(), input)
+}
+
+// GenerateWithContext is Generate canceled with the context
+func (s *SAMLAssertionV2) GenerateWithContext(ctx context.Context, input *GenerateRequest) (*GenerateResponse, error) {
+	output, err := s.post(ctx, endpoint.URL(s.config.Endpoint, "/api/2/saml_assertion"), input)
+	if err != nil {
+		return nil, err
+	}
+	if output.Status.Error {
+		return nil, errors.Errorf("[%d] %s: %s", output.Status.Code, output.Status.Type, output.Status.Message)
+	}
+	response := &GenerateResponse{
+		Status: &GenerateResponseStatus{
+			Type:    output.Status.Type,
+			Message: output.Status.Message,
+			Code:    output.Status.Code,
+		},
+	}
+	if output.StateToken == "" {
+		if output.SAML == "" {
+			return nil, errors.Errorf("SAML assertion is not exists in the response: %s", output.Status.Message)
+		}
+		response.SAML = output.SAML
+		return response, nil
+	}
+	response.Factors = []GenerateResponseFactor{
+		{
+			StateToken:  output.StateToken,
+			Devices:     withNotifyDevices(output.Devices),
+			CallbackURL: output.CallbackURL,
+			User:        output.User,
+		},
+	}
+	return response, nil
+}
+
+// VerifyFactor call verify factor v2
+func (s *SAMLAssertionV2) VerifyFactor(input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
+	return s.VerifyFactorWithContext(context.Background(), input)
+}
+
+// VerifyFactorWithContext is VerifyFactor canceled with the context, polling the pending push notification like API v1
+func (s *SAMLAssertionV2) VerifyFactorWithContext(ctx context.Context, input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
+	return verifyWithPoller(ctx, s.Poller, input, s.verifyFactor)
+}
+
+func (s *SAMLAssertionV2) verifyFactor(ctx context.Context, input *VerifyFactorRequest) (*VerifyFactorResponse, error) {
+	output, err := s.post(ctx, verifyFactorURL(s.config, input.CallbackURL, "/api/2/saml_assertion/verify_factor"), input)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifyFactorResponse{
+		Status: output.Status,
+		SAML:   output.SAML,
+	}, nil
+}
+
+// verifiedResponseV2 is the response of API v2 with the status of API v1
+type verifiedResponseV2 struct {
+	responseV2
+	Status *VerifyFactorResponseStatus
+}
+
+// post requests API v2 and converts the HTTP status into the status of API v1
+func (s *SAMLAssertionV2) post(ctx context.Context, url string, input interface{}) (*verifiedResponseV2, error) {
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	code, body, err := post(ctx, s.HTTPClient, s.config, url, authorizationV2, inputJSON)
+	if err != nil {
+		return nil, err
+	}
+	if code >= http.StatusBadRequest {
+		var e errorResponseV2
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, errors.Errorf("[%d] %s", code, http.StatusText(code))
+		}
+		if e.StatusCode == 0 {
+			e.StatusCode = code
+		}
+		if e.Name == "" {
+			e.Name = http.StatusText(code)
+		}
+		return &verifiedResponseV2{
+			Status: &VerifyFactorResponseStatus{
+				Type:    e.Name,
+				Message: e.Message,
+				Error:   true,
+				Code:    e.StatusCode,
+			},
+		}, nil
+	}
+	var output verifiedResponseV2
+	if err := json.Unmarshal(body, &output.responseV2); err != nil {
+		return nil, err
+	}
+	output.Status = &VerifyFactorResponseStatus{
+		Type:    "success",
+		Message: output.Message,
+		Code:    code,
+	}
+	if output.SAML == "" && strings.Contains(strings.ToLower(output.Message), "pending") {
+		output.Status.Type = "pending"
+	}
+	return &output, nil
+}
@@ -0,0 +1,210 @@
+package samlassertion
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/credentials"
+)
+
+type responseV2Fake struct {
+	code int
+	body string
+}
+
+// newSAMLAssertionV2 returns SAMLAssertionV2 of the fake server answering the responses in order
+func newSAMLAssertionV2(t *testing.T, path string, responses ...responseV2Fake) (*SAMLAssertionV2, func()) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("%s is not equal %s", r.URL.Path, path)
+		}
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			t.Errorf("%s is not equal %s", r.Header.Get("Authorization"), "Bearer access-token")
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var input map[string]interface{}
+		if err := json.Unmarshal(body, &input); err != nil {
+			t.Errorf("%v", err)
+		}
+		res := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		w.WriteHeader(res.code)
+		fmt.Fprint(w, res.body)
+	}))
+	u, _ := url.Parse(ts.URL)
+	s := &SAMLAssertionV2{
+		config: &onelogin.Config{
+			Endpoint: u.Host,
+			Credentials: credentials.New(nil, &credentials.Value{
+				AccessToken:      "access-token",
+				AccessExpiresAt:  time.Now().Add(time.Minute),
+				RefreshExpiresAt: time.Now().Add(time.Minute),
+			}),
+		},
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		Poller: &Poller{
+			Interval: time.Millisecond,
+			Timeout:  time.Second,
+		},
+	}
+	return s, ts.Close
+}
+
+func TestSAMLAssertionV2_Generate(t *testing.T) {
+	request := &GenerateRequest{
+		UsernameOrEmail: "username-or-email",
+		Password:        "password",
+		AppID:           "app-id",
+		Subdomain:       "subdomain",
+	}
+	tests := []struct {
+		name    string
+		res     responseV2Fake
+		want    *GenerateResponse
+		wantErr bool
+	}{
+		{
+			name: "success",
+			res: responseV2Fake{
+				code: 200,
+				body: `{"data": "Base64 Encoded SAML Data", "message": "Success"}`,
+			},
+			want: &GenerateResponse{
+				Status: &GenerateResponseStatus{Type: "success", Message: "Success", Code: 200},
+				SAML:   "Base64 Encoded SAML Data",
+			},
+		},
+		{
+			name: "mfa",
+			res: responseV2Fake{
+				code: 200,
+				body: `{
+					"state_token": "state-token",
+					"message": "MFA is required for this user",
+					"devices": [{"device_id": 666666, "device_type": "OneLogin Protect"}],
+					"callback_url": "https://api.us.onelogin.com/api/2/saml_assertion/verify_factor",
+					"user": {"lastname": "Doe", "username": "jdoe", "email": "jdoe@example.com", "firstname": "John", "id": 88888888}
+				}`,
+			},
+			want: &GenerateResponse{
+				Status: &GenerateResponseStatus{Type: "success", Message: "MFA is required for this user", Code: 200},
+				Factors: []GenerateResponseFactor{
+					{
+						StateToken: "state-token",
+						Devices: []GenerateResponseFactorDevice{
+							{DeviceID: 666666, DeviceType: "OneLogin Protect", RequireOTPToken: true},
+							{DeviceID: 666666, DeviceType: NotifyDeviceType, RequireOTPToken: false},
+						},
+						CallbackURL: "https://api.us.onelogin.com/api/2/saml_assertion/verify_factor",
+						User: &GenerateResponseFactorUser{
+							LastName:  "Doe",
+							UserName:  "jdoe",
+							Email:     "jdoe@example.com",
+							FirstName: "John",
+							ID:        88888888,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unauthorized",
+			res: responseV2Fake{
+				code: 401,
+				body: `{"statusCode": 401, "name": "Unauthorized", "message": "Authentication Failed"}`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "no JSON error",
+			res: responseV2Fake{
+				code: 500,
+				body: `Internal Server Error`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid JSON",
+			res: responseV2Fake{
+				code: 200,
+				body: `invalid`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, close := newSAMLAssertionV2(t, "/api/2/saml_assertion", tt.res)
+			defer close()
+			got, err := s.Generate(request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SAMLAssertionV2.Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SAMLAssertionV2.Generate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSAMLAssertionV2_VerifyFactor(t *testing.T) {
+	request := &VerifyFactorRequest{
+		AppID:      "app-id",
+		DeviceID:   "device-id",
+		StateToken: "state-token",
+		OtpToken:   "123456",
+	}
+	s, close := newSAMLAssertionV2(t, "/api/2/saml_assertion/verify_factor", responseV2Fake{
+		code: 200,
+		body: `{"data": "Base64 Encoded SAML Data", "message": "Success"}`,
+	})
+	defer close()
+	got, err := s.VerifyFactor(request)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if got == nil || got.SAML != "Base64 Encoded SAML Data" || got.Status.Type != "success" {
+		t.Errorf("%+v is not verified", got)
+	}
+}
+
+func TestSAMLAssertionV2_VerifyFactorPoll(t *testing.T) {
+	pending := responseV2Fake{code: 200, body: `{"message": "Authentication pending on OL Protect"}`}
+	s, close := newSAMLAssertionV2(t, "/api/2/saml_assertion/verify_factor", pending, pending, responseV2Fake{
+		code: 200,
+		body: `{"data": "Base64 Encoded SAML Data", "message": "Success"}`,
+	})
+	defer close()
+	got, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if got == nil || got.SAML != "Base64 Encoded SAML Data" {
+		t.Errorf("%+v is not approved", got)
+	}
+
+	s, close = newSAMLAssertionV2(t, "/api/2/saml_assertion/verify_factor", pending, responseV2Fake{
+		code: 401,
+		body: `{"statusCode": 401, "name": "Unauthorized", "message": "Authentication Failed"}`,
+	})
+	defer close()
+	if _, err := s.VerifyFactorWithContext(context.Background(), &VerifyFactorRequest{AppID: "app-id"}); err != ErrDenied {
+		t.Errorf("%v is not equal %v", err, ErrDenied)
+	}
+}
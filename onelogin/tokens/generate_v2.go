@@ -2,12 +2,16 @@ package tokens
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/pkg/errors"
+
+	"github.com/lifull-dev/onelogin-aws-connector/logging"
+	"github.com/lifull-dev/onelogin-aws-connector/onelogin/endpoint"
 )
 
 // https://developers.onelogin.com/api-docs/1/oauth20-tokens/generate-tokens-2
@@ -57,12 +61,17 @@ type Tokens struct {
 // NewTokens creates a Tokens
 func NewTokens() *Tokens {
 	return &Tokens{
-		HTTPClient: &http.Client{},
+		HTTPClient: &http.Client{Transport: logging.NewTransport(nil)},
 	}
 }
 
 // Generate retrive access_token and other
 func (g *Tokens) Generate() (*GenerateResponse, error) {
+	return g.GenerateWithContext(context.Background())
+}
+
+// GenerateWithContext is Generate canceled with the context
+func (g *Tokens) GenerateWithContext(ctx context.Context) (*GenerateResponse, error) {
 	input := &GenerateRequest{
 		GrantType: "client_credentials",
 	}
@@ -70,8 +79,8 @@ func (g *Tokens) Generate() (*GenerateResponse, error) {
 	if err != nil {
 		return nil, err
 	}
-	url := fmt.Sprintf("https://%s/auth/oauth2/v2/token", g.Endpoint)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(inputJSON)))
+	url := endpoint.URL(g.Endpoint, "/auth/oauth2/v2/token")
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(inputJSON)))
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +90,9 @@ func (g *Tokens) Generate() (*GenerateResponse, error) {
 	client := g.HTTPClient
 	res, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 	defer res.Body.Close()
@@ -100,13 +112,18 @@ func (g *Tokens) Generate() (*GenerateResponse, error) {
 
 // Refresh retrive access_token and other by refresh_token
 func (g *Tokens) Refresh(input *RefreshRequest) (*RefreshResponse, error) {
+	return g.RefreshWithContext(context.Background(), input)
+}
+
+// RefreshWithContext is Refresh canceled with the context
+func (g *Tokens) RefreshWithContext(ctx context.Context, input *RefreshRequest) (*RefreshResponse, error) {
 	input.GrantType = "refresh_token"
 	inputJSON, err := json.Marshal(input)
 	if err != nil {
 		return nil, err
 	}
-	url := fmt.Sprintf("https://%s/auth/oauth2/v2/token", g.Endpoint)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(inputJSON)))
+	url := endpoint.URL(g.Endpoint, "/auth/oauth2/v2/token")
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(inputJSON)))
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +131,9 @@ func (g *Tokens) Refresh(input *RefreshRequest) (*RefreshResponse, error) {
 	client := g.HTTPClient
 	res, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 	defer res.Body.Close()